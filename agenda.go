@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+var (
+	withTasks   bool
+	outputDir   string
+	limit       int
+	primaryOnly bool
+)
+
+func init() {
+	flag.BoolVar(&withTasks, "tasks", false, "Include Google Tasks due in the window")
+	flag.StringVar(&outputDir, "output-dir", "", "Write one file per calendar into this directory instead of stdout")
+	flag.IntVar(&limit, "limit", 0, "Only output the next N events that haven't ended yet (0 for all)")
+	flag.BoolVar(&primaryOnly, "primary", false, "Only read your primary calendar, without listing the others (faster)")
+}
+
+// localZone is the timezone events are shown in.
+func localZone() (*time.Location, error) {
+	return time.LoadLocation("America/Montreal")
+}
+
+// runAgenda is what gcal does when no command is given: print the
+// events in the window in the selected format.
+func runAgenda(ctx context.Context) error {
+	// Counting needs no format, but -format json counts by calendar.
+	if !countOnly || format != "" {
+		if err := checkFormat(); err != nil {
+			return err
+		}
+	}
+	if err := checkNoExpand(); err != nil {
+		return err
+	}
+	if _, err := parseFilters(); err != nil {
+		return err
+	}
+	if err := loadAlsoZones(); err != nil {
+		return err
+	}
+	if withTasks && prof.Provider != "google" {
+		return usageError("tasks are only available from Google")
+	}
+	// Our local timezone
+	localzone, err := localZone()
+	if err != nil {
+		return err
+	}
+	events, calendars, err := agendaEvents(ctx, duration, localzone)
+	if err != nil {
+		return err
+	}
+	if countOnly {
+		err = printCount(os.Stdout, events, calendars)
+	} else {
+		err = printEvents(events, calendars)
+	}
+	if format == "taskwarrior" && (err == nil || err == errNoEvents) {
+		if serr := saveTWUUIDs(); serr != nil {
+			return serr
+		}
+	}
+	if showSummary && (err == nil || err == errNoEvents) {
+		line, serr := runSummary(events, calendars)
+		if serr != nil {
+			return serr
+		}
+		fmt.Fprintln(os.Stderr, line)
+	}
+	return err
+}
+
+// agendaEvents is everything that goes in the agenda: the events in
+// the window, with -tasks the tasks due in it, less what the filters
+// drop, with -buffer's travel blocks, with private events masked, anonymized with -anonymize and cut
+// short with -limit. It also returns the calendars that were read.
+func agendaEvents(ctx context.Context, dur string, localzone *time.Location) ([]*agendaEvent, []*calendar.CalendarListEntry, error) {
+	events, calendars, err := fetchEvents(ctx, dur, localzone)
+	if err != nil {
+		return nil, nil, err
+	}
+	if withTasks {
+		tasklist, err := collectTasks(ctx, dur, localzone)
+		if err != nil {
+			return nil, nil, err
+		}
+		events = append(events, tasklist...)
+	}
+	tagEvents(events)
+	if events, err = applyFilters(events); err != nil {
+		return nil, nil, err
+	}
+	events = addBuffers(events)
+	if maskingPrivate() {
+		events = maskPrivate(events)
+	}
+	if anonymize {
+		events = anonymizeEvents(events)
+	}
+	if limit > 0 {
+		events = limitEvents(time.Now(), events, limit)
+	}
+	return events, calendars, nil
+}
+
+// fetchEvents reads the events in the window from every source. It also
+// returns the calendars that were read.
+func fetchEvents(ctx context.Context, dur string, localzone *time.Location) ([]*agendaEvent, []*calendar.CalendarListEntry, error) {
+	if readPrimary() {
+		return fetchPrimary(ctx, dur, localzone)
+	}
+	ps, err := sources(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	events := make([]*agendaEvent, 0)
+	all_calendars := make([]*calendar.CalendarListEntry, 0)
+	feeds := make([]*calendar.CalendarListEntry, 0)
+	read := make([]*calendar.CalendarListEntry, 0)
+	for i, p := range ps {
+		// The feeds are read along with their calendars, so only the
+		// main provider's list is worth caching.
+		var calendar_list []*calendar.CalendarListEntry
+		if i == 0 && replayDir == "" {
+			calendar_list, err = cachedCalendars(ctx, p)
+		} else {
+			calendar_list, err = p.Calendars(ctx)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		all_calendars = append(all_calendars, calendar_list...)
+		if i > 0 {
+			feeds = append(feeds, calendar_list...)
+		}
+		calendar_list = selectCalendars(calendar_list)
+		read = append(read, calendar_list...)
+		collected, err := collectEvents(ctx, p, calendar_list, dur, localzone)
+		if err != nil {
+			return nil, nil, err
+		}
+		events = append(events, collected...)
+	}
+	dumpCalendars(all_calendars)
+	if replayDir != "" {
+		return events, read, nil
+	}
+	// Remember the feeds' calendars for shell completion.
+	if err := rememberFeeds(feeds); err != nil {
+		log.Warningf("unable to cache calendar list: %v", err)
+	}
+	return events, read, nil
+}
+
+// readPrimary tells whether to read the primary calendar alone: with
+// -primary, or by the profile's default when no -calendar is given.
+func readPrimary() bool {
+	return primaryOnly || (prof.Primary && calnames == "")
+}
+
+// fetchPrimary reads the events of the primary calendar alone, without
+// listing the calendars, for -primary.
+func fetchPrimary(ctx context.Context, dur string, localzone *time.Location) ([]*agendaEvent, []*calendar.CalendarListEntry, error) {
+	p, err := newProvider(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	g, ok := p.(primaryGetter)
+	if !ok {
+		return nil, nil, usageError("the %s provider has no primary calendar", prof.Provider)
+	}
+	item, err := g.Primary(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The primary calendar rarely has a description to name it by.
+	if strings.TrimSpace(item.Description) == "" {
+		item.Description = item.Summary
+	}
+	read := []*calendar.CalendarListEntry{item}
+	dumpCalendars(read)
+	events, err := collectEvents(ctx, p, read, dur, localzone)
+	if err != nil {
+		return nil, nil, err
+	}
+	return events, read, nil
+}
+
+// limitEvents keeps the first n events, across all calendars, that
+// haven't ended by now.
+func limitEvents(now time.Time, events []*agendaEvent, n int) []*agendaEvent {
+	upcoming := make([]*agendaEvent, 0, n)
+	for _, ev := range sortedByStart(events) {
+		if len(upcoming) == n {
+			break
+		}
+		if ev.End.After(now) {
+			upcoming = append(upcoming, ev)
+		}
+	}
+	return upcoming
+}
+
+// checkFormat validates the -format flag before we go to the trouble of
+// fetching anything.
+func checkFormat() error {
+	if format == "" {
+		flag.Usage()
+		return usageError("no output format given")
+	}
+	if _, ok := formatters[format]; !ok {
+		return usageError("unsupported format: %s", format)
+	}
+	if orgStyle != "flat" && orgStyle != "weektree" {
+		return usageError("-org-style must be flat or weektree, not %s", orgStyle)
+	}
+	if err := checkRemind(); err != nil {
+		return err
+	}
+	if colorMode != "auto" && colorMode != "always" && colorMode != "never" {
+		return usageError("-color must be auto, always or never, not %s", colorMode)
+	}
+	return nil
+}
+
+// outputFile returns the file a calendar's events go to, or "" for
+// stdout. With -output-dir every calendar gets a file, named after it
+// unless its settings say otherwise.
+func outputFile(name, id string, settings *calendarConfig) string {
+	file := settings.File
+	if outputDir == "" {
+		return file
+	}
+	if file == "" {
+		if name == "" {
+			name = id
+		}
+		ext, ok := formatExtensions[format]
+		if !ok {
+			ext = ".txt"
+		}
+		file = sanitizeFilename(name) + ext
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(outputDir, file)
+	}
+	return file
+}
+
+// sanitizeFilename turns a calendar name into something safe to use as a
+// file name anywhere.
+func sanitizeFilename(name string) string {
+	var sb strings.Builder
+	underscore := false
+	for _, r := range strings.TrimSpace(name) {
+		if r < 128 && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '.') {
+			sb.WriteRune(r)
+			underscore = false
+		} else if !underscore {
+			sb.WriteRune('_')
+			underscore = true
+		}
+	}
+	clean := strings.Trim(sb.String(), "._")
+	if clean == "" {
+		clean = "calendar"
+	}
+	return clean
+}
+
+// printEvents writes the events to stdout in the selected format, except
+// for the calendars that have a file of their own. Those files are
+// rewritten for every calendar that was read, even if it had no events.
+func printEvents(events []*agendaEvent, calendars []*calendar.CalendarListEntry) error {
+	files := map[string][]*agendaEvent{}
+	for _, item := range calendars {
+		if file := outputFile(calendarName(item), item.Id, calendarSettings(item)); file != "" {
+			files[file] = make([]*agendaEvent, 0)
+		}
+	}
+	stdout := make([]*agendaEvent, 0, len(events))
+	for _, ev := range events {
+		if file := outputFile(ev.Calendar, ev.CalendarID, ev.Settings); file != "" {
+			files[file] = append(files[file], ev)
+		} else {
+			stdout = append(stdout, ev)
+		}
+	}
+
+	if len(stdout) > 0 || len(files) == 0 {
+		out := bufio.NewWriter(os.Stdout)
+		if err := formatters[format](out, stdout); err != nil {
+			return err
+		}
+		if err := out.Flush(); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(outputDir); outputDir != "" && err != nil {
+		err := mutate("create directory "+outputDir, func() error {
+			return os.MkdirAll(outputDir, 0755)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for file, fileEvents := range files {
+		var buf bytes.Buffer
+		if err := formatters[format](&buf, fileEvents); err != nil {
+			return err
+		}
+		if err := writeFile(file, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	if len(events) == 0 {
+		return errNoEvents
+	}
+	return nil
+}
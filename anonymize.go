@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"strings"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+var anonymize bool
+
+func init() {
+	flag.BoolVar(&anonymize, "anonymize", false, "Replace summaries and calendar names by hashes and drop everything personal, keeping times")
+}
+
+// anonymousName is a stand-in for a name that is the same wherever the
+// name is, so that anonymized output can still be grouped by it.
+func anonymousName(prefix, name string) string {
+	if name == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(strings.TrimSpace(name)))
+	return prefix + "-" + hex.EncodeToString(sum[:4])
+}
+
+// anonymizeEvents rewrites the events so that only their times, lengths,
+// statuses and a hash of their summaries and calendars are left. The
+// events are copied, not changed in place.
+func anonymizeEvents(events []*agendaEvent) []*agendaEvent {
+	anonymized := make([]*agendaEvent, 0, len(events))
+	for _, ev := range events {
+		copied := *ev
+		copied.Event = &calendar.Event{
+			Id:                ev.Id,
+			Summary:           anonymousName("event", ev.Summary),
+			Start:             ev.Event.Start,
+			End:               ev.Event.End,
+			Status:            ev.Status,
+			Transparency:      ev.Transparency,
+			Visibility:        ev.Visibility,
+			EventType:         ev.EventType,
+			RecurringEventId:  ev.RecurringEventId,
+			OriginalStartTime: ev.OriginalStartTime,
+			Reminders:         ev.Reminders,
+		}
+		// Keep our own response, which says whether we're busy, without
+		// saying who we are.
+		for _, att := range ev.Attendees {
+			if att.Self {
+				copied.Attendees = []*calendar.EventAttendee{{Self: true, ResponseStatus: att.ResponseStatus}}
+			}
+		}
+		copied.Calendar = anonymousName("calendar", ev.Calendar)
+		settings := *ev.Settings
+		settings.Prefix = ""
+		settings.Name = ""
+		copied.Settings = &settings
+		anonymized = append(anonymized, &copied)
+	}
+	return anonymized
+}
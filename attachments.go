@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+var attachmentsDir string
+
+func init() {
+	register(&command{
+		name:     "attachments",
+		args:     "list|download event-id",
+		summary:  "List or download the files attached to an event",
+		complete: []string{"list", "download"},
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&attachmentsDir, "dir", ".", "Directory to download the files into")
+		},
+		run: runAttachments,
+	})
+}
+
+// exportTypes are what Google's own documents, which have no file to
+// download, are exported as.
+var exportTypes = map[string]struct{ mimeType, ext string }{
+	"application/vnd.google-apps.document":     {"application/pdf", ".pdf"},
+	"application/vnd.google-apps.presentation": {"application/pdf", ".pdf"},
+	"application/vnd.google-apps.drawing":      {"application/pdf", ".pdf"},
+	"application/vnd.google-apps.spreadsheet":  {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", ".xlsx"},
+}
+
+// attachmentName is the file name to save an attachment as: its title,
+// made safe, with the extension of what it is exported as, if it is.
+func attachmentName(a *calendar.EventAttachment) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(a.Title))
+	if name == "" || name == "." || name == ".." {
+		name = "attachment"
+	}
+	if export, ok := exportTypes[a.MimeType]; ok && !strings.HasSuffix(strings.ToLower(name), export.ext) {
+		name += export.ext
+	}
+	return name
+}
+
+// driveError explains a refusal from Drive that comes from the token not
+// allowing gcal to read it.
+func driveError(err error, title string) error {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) && gerr.Code == http.StatusForbidden &&
+		strings.Contains(strings.ToLower(gerr.Error()), "scope") {
+		return authError("unable to download %s (%v); run gcal auth -force -drive "+
+			"to let gcal read your attachments", title, err)
+	}
+	return requestError(err, "unable to download %s", title)
+}
+
+// download fetches one attachment into a file. Files in Drive go through
+// the Drive API, exported if they are Google documents; anything else is
+// fetched from its URL.
+func download(ctx context.Context, srv *drive.Service, a *calendar.EventAttachment, path string) error {
+	var resp *http.Response
+	var err error
+	switch export, ok := exportTypes[a.MimeType]; {
+	case a.FileId != "" && ok:
+		resp, err = srv.Files.Export(a.FileId, export.mimeType).Context(ctx).Download()
+	case a.FileId != "":
+		resp, err = srv.Files.Get(a.FileId).SupportsAllDrives(true).Context(ctx).Download()
+	default:
+		resp, err = httpClient(0).Get(a.FileUrl)
+		if err == nil && resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			err = fmt.Errorf("%s", resp.Status)
+		}
+	}
+	if err != nil {
+		return driveError(err, a.Title)
+	}
+	defer resp.Body.Close()
+	return mutate("download "+a.Title+" to "+path, func() error {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, resp.Body); err != nil {
+			f.Close()
+			return apiError("unable to download %s: %v", a.Title, err)
+		}
+		return f.Close()
+	})
+}
+
+func runAttachments(args []string) error {
+	if len(args) != 2 || (args[0] != "list" && args[0] != "download") {
+		return usageError("usage: gcal attachments list|download event-id")
+	}
+	if _, err := parseFilters(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	ev, err := findEvent(ctx, args[1])
+	if err != nil {
+		return err
+	}
+	if len(ev.Attachments) == 0 {
+		return usageError("%s has no attachments", summary(ev))
+	}
+	if args[0] == "list" {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		for _, a := range ev.Attachments {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", a.Title, a.MimeType, a.FileUrl)
+		}
+		return tw.Flush()
+	}
+
+	var srv *drive.Service
+	if prof.Provider == "google" {
+		client, err := googleClient()
+		if err != nil {
+			return err
+		}
+		if srv, err = drive.NewService(ctx, option.WithHTTPClient(client)); err != nil {
+			return apiError("unable to retrieve Drive client: %v", err)
+		}
+	}
+	if _, err := os.Stat(attachmentsDir); err != nil {
+		err := mutate("create directory "+attachmentsDir, func() error {
+			return os.MkdirAll(attachmentsDir, 0755)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, a := range ev.Attachments {
+		if a.FileId != "" && srv == nil {
+			log.Warningf("skipping %s: only Google can download files from Drive", a.Title)
+			continue
+		}
+		path := filepath.Join(attachmentsDir, attachmentName(a))
+		if err := download(ctx, srv, a, path); err != nil {
+			return err
+		}
+		fmt.Println(path)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/drive/v3"
+)
+
+var (
+	authForce bool
+	authWrite bool
+	authDrive bool
+	// forceAuth makes getClient run the authorization flow even if there
+	// is a saved token.
+	forceAuth bool
+	// tokens is the token source of the provider's client, once there is
+	// one.
+	tokens oauth2.TokenSource
+)
+
+// tokenEarlyExpiry is how long before it expires an access token gets
+// refreshed, so that a daemon never makes a request with a stale one.
+const tokenEarlyExpiry = 5 * time.Minute
+
+func init() {
+	register(&command{
+		name:    "auth",
+		summary: "Check the saved authorization, or with -force authorize gcal again",
+		flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&authForce, "force", false, "Run the authorization flow even if the saved token works")
+			fs.BoolVar(&authWrite, "write", false, "Ask for write access too, for the commands that change events (Google only; implies -force)")
+			fs.BoolVar(&authDrive, "drive", false, "Ask for read access to Google Drive too, for downloading attachments (implies -force)")
+		},
+		run: runAuth,
+	})
+}
+
+// tokenRefresher gets a new access token every time it is asked, unlike
+// the config's own token source, which holds on to a token until it
+// expires.
+type tokenRefresher struct {
+	ctx    context.Context
+	config *oauth2.Config
+	tok    *oauth2.Token
+	file   string
+}
+
+func (r *tokenRefresher) Token() (*oauth2.Token, error) {
+	tok, err := r.config.TokenSource(r.ctx, &oauth2.Token{RefreshToken: r.tok.RefreshToken}).Token()
+	if err != nil {
+		return nil, err
+	}
+	r.tok = tok
+	log.Debugf("Refreshed the access token, now valid until %s", tok.Expiry)
+	if err := writeToken(r.file, tok); err != nil {
+		log.Warningf("unable to save the refreshed token: %v", err)
+	}
+	return tok, nil
+}
+
+// isInvalidGrant tells whether err comes from the refresh token having
+// expired or been revoked, which only authorizing again fixes.
+func isInvalidGrant(err error) bool {
+	var rerr *oauth2.RetrieveError
+	return errors.As(err, &rerr) && rerr.ErrorCode == "invalid_grant"
+}
+
+func reauthError() error {
+	return authError("the authorization saved in %s has expired or been revoked; "+
+		"run gcal auth -force to authorize gcal again", prof.Token)
+}
+
+// requestError is apiError for a failed request to an OAuth service,
+// except that a refused token gets instructions to authorize again.
+func requestError(err error, format string, args ...interface{}) error {
+	if isInvalidGrant(err) {
+		return reauthError()
+	}
+	return apiError(format+": %w", append(args, err)...)
+}
+
+// authorize makes sure we have a working token, running the
+// authorization flow if there is none or force is set.
+func authorize(ctx context.Context, force bool) (*oauth2.Token, error) {
+	forceAuth = force
+	var err error
+	switch prof.Provider {
+	case "google":
+		_, err = googleClient()
+	case "msgraph":
+		_, err = newMSGraphProvider(ctx)
+	default:
+		return nil, usageError("the %s provider doesn't need authorizing", prof.Provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tok, err := tokens.Token()
+	if isInvalidGrant(err) {
+		return nil, reauthError()
+	}
+	if err != nil {
+		return nil, authError("unable to get an access token: %v", err)
+	}
+	return tok, nil
+}
+
+func runAuth(args []string) error {
+	if authWrite {
+		if prof.Provider != "google" {
+			return usageError("write access is only available with Google")
+		}
+		scopes = append(scopes, calendar.CalendarEventsScope)
+	}
+	if authDrive {
+		if prof.Provider != "google" {
+			return usageError("Drive access is only available with Google")
+		}
+		scopes = append(scopes, drive.DriveReadonlyScope)
+	}
+	// The saved token doesn't say which scopes it has, so asking for more
+	// means authorizing again.
+	tok, err := authorize(context.Background(), authForce || authWrite || authDrive)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "%s: authorized, access token valid until %s\n",
+		prof.Token, tok.Expiry.Local().Format(time.RFC1123))
+	return nil
+}
+
+// keepTokenFresh refreshes the access token ahead of its expiry for as
+// long as ctx lasts, so that a long-running server notices a revoked
+// authorization in its log rather than in a failed request.
+func keepTokenFresh(ctx context.Context, every time.Duration) {
+	if tokens == nil {
+		return
+	}
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := tokens.Token(); isInvalidGrant(err) {
+				log.Errorf("%v", reauthError())
+			} else if err != nil {
+				log.Warningf("unable to refresh the access token: %v", err)
+			}
+		}
+	}
+}
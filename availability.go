@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	availDays   int
+	availSlot   time.Duration
+	availFormat string
+	availZone   string
+)
+
+func init() {
+	register(&command{
+		name:    "availability",
+		summary: "Print when you are free in the coming working days, ready to paste into an email",
+		flags: func(fs *flag.FlagSet) {
+			fs.IntVar(&availDays, "days", 5, "Number of working days to cover")
+			fs.DurationVar(&availSlot, "slot", 30*time.Minute, "Shortest free time worth offering")
+			fs.StringVar(&availFormat, "format", "text", "Output format (text|html)")
+			fs.StringVar(&availZone, "tz", "", "Time zone of the recipient, e.g. Europe/Paris (default ours)")
+		},
+		run: runAvailability,
+	})
+}
+
+// Without -business-hours and -weekdays, we offer the usual working hours.
+const (
+	defaultWorkHours = "09:00-17:00"
+	defaultWorkDays  = "mon-fri"
+)
+
+// workingDays are the midnights of the next n working days from start.
+func workingDays(start time.Time, days map[time.Weekday]bool, n int) []time.Time {
+	found := make([]time.Time, 0, n)
+	for day := midnight(start); len(found) < n; day = day.AddDate(0, 0, 1) {
+		if days[day.Weekday()] {
+			found = append(found, day)
+		}
+	}
+	return found
+}
+
+// freeTimes are the free intervals of at least slot in the working hours
+// of the days, from now on.
+func freeTimes(now time.Time, events []*agendaEvent, days []time.Time, f *filters, slot time.Duration) []interval {
+	busy := make([]interval, 0, len(events))
+	for _, ev := range events {
+		if isMeeting(ev) && ev.End.After(ev.Start) {
+			busy = append(busy, interval{ev.Start, ev.End})
+		}
+	}
+	busy = mergeIntervals(busy)
+	// Nobody wants to be offered 10:07.
+	soonest := now.Truncate(15 * time.Minute)
+	if soonest.Before(now) {
+		soonest = soonest.Add(15 * time.Minute)
+	}
+	free := make([]interval, 0)
+	for _, day := range days {
+		span := interval{
+			time.Date(day.Year(), day.Month(), day.Day(), f.from/60, f.from%60, 0, 0, day.Location()),
+			time.Date(day.Year(), day.Month(), day.Day(), f.to/60, f.to%60, 0, 0, day.Location()),
+		}
+		if span.Start.Before(soonest) {
+			span.Start = soonest
+		}
+		if span.End.After(span.Start) {
+			free = append(free, freeIntervals(busy, span, slot)...)
+		}
+	}
+	return free
+}
+
+// availableDay is the free times on one day, in the recipient's zone.
+type availableDay struct {
+	day   time.Time
+	times []interval
+}
+
+// byDay groups the free times by day in zone, splitting those that go
+// past midnight there.
+func byDay(free []interval, zone *time.Location) []*availableDay {
+	grouped := make([]*availableDay, 0)
+	for _, iv := range free {
+		start, end := iv.Start.In(zone), iv.End.In(zone)
+		for start.Before(end) {
+			next := midnight(start).AddDate(0, 0, 1)
+			part := interval{start, end}
+			if next.Before(end) {
+				part.End = next
+			}
+			if n := len(grouped); n == 0 || !sameDay(grouped[n-1].day, start) {
+				grouped = append(grouped, &availableDay{day: midnight(start)})
+			}
+			last := grouped[len(grouped)-1]
+			last.times = append(last.times, part)
+			start = part.End
+		}
+	}
+	return grouped
+}
+
+func (d *availableDay) String() string {
+	times := make([]string, 0, len(d.times))
+	for _, iv := range d.times {
+		end := iv.End.Format("15:04")
+		if iv.End.Equal(midnight(iv.End)) {
+			end = "24:00"
+		}
+		times = append(times, iv.Start.Format("15:04")+"–"+end)
+	}
+	return strings.Join(times, ", ")
+}
+
+func writeAvailability(w io.Writer, days []*availableDay, zone *time.Location) {
+	note := fmt.Sprintf("Times are in %s.", zone)
+	if availFormat == "html" {
+		fmt.Fprintln(w, "<ul>")
+		for _, d := range days {
+			fmt.Fprintf(w, "  <li><strong>%s</strong> %s</li>\n",
+				html.EscapeString(localDate(d.day, "Mon Jan 2")), html.EscapeString(d.String()))
+		}
+		fmt.Fprintln(w, "</ul>")
+		fmt.Fprintf(w, "<p>%s</p>\n", html.EscapeString(note))
+		return
+	}
+	for _, d := range days {
+		fmt.Fprintf(w, "%s: %s\n", localDate(d.day, "Mon Jan 2"), d)
+	}
+	fmt.Fprintln(w, note)
+}
+
+// workingFreeTimes are the free times of at least slot in the working
+// hours of the next n working days, from now on. Without
+// -business-hours and -weekdays, the working hours are the usual ones.
+func workingFreeTimes(ctx context.Context, n int, slot time.Duration) ([]interval, error) {
+	if businessHours == "" {
+		businessHours = defaultWorkHours
+	}
+	if weekdays == "" {
+		weekdays = defaultWorkDays
+	}
+	f, err := parseFilters()
+	if err != nil {
+		return nil, err
+	}
+	localzone, err := localZone()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().In(localzone)
+	start, _, err := agendaWindow(now, "1d")
+	if err != nil {
+		return nil, err
+	}
+	// The window starts at midnight in the system's zone, on the day we
+	// want.
+	first := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, localzone)
+	days := workingDays(first, f.days, n)
+	// Read the events up to the end of the last working day.
+	span := 0
+	for day := first; !day.After(days[len(days)-1]); day = day.AddDate(0, 0, 1) {
+		span++
+	}
+	events, _, err := agendaEvents(ctx, fmt.Sprintf("%dd", span), localzone)
+	if err != nil {
+		return nil, err
+	}
+	return freeTimes(now, events, days, f, slot), nil
+}
+
+func runAvailability(args []string) error {
+	if len(args) != 0 {
+		return usageError("usage: gcal availability")
+	}
+	if availFormat != "text" && availFormat != "html" {
+		return usageError("-format must be text or html, not %s", availFormat)
+	}
+	if availDays < 1 {
+		return usageError("-days must be at least 1")
+	}
+	if availSlot <= 0 {
+		return usageError("-slot must be positive")
+	}
+	zone, err := localZone()
+	if err != nil {
+		return err
+	}
+	if availZone != "" {
+		if zone, err = time.LoadLocation(availZone); err != nil {
+			return usageError("bad -tz: %v", err)
+		}
+	}
+	free, err := workingFreeTimes(context.Background(), availDays, availSlot)
+	if err != nil {
+		return err
+	}
+	if len(free) == 0 {
+		log.Warningf("no free time of %v or more in the next %d working days", availSlot, availDays)
+		return nil
+	}
+	writeAvailability(os.Stdout, byDay(free, zone), zone)
+	return nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+var (
+	qps      float64
+	parallel int
+	failFast bool
+)
+
+func init() {
+	flag.Float64Var(&qps, "qps", 0, "Most requests per second to send, to stay within the per-user quota (default: the profile's qps, or 5)")
+	flag.IntVar(&parallel, "parallel", 4, "Number of calendars to read at once")
+	flag.BoolVar(&failFast, "fail-fast", false, "Stop at the first calendar that can't be read instead of skipping it")
+}
+
+// defaultQPS keeps well within Google's default per-user quota.
+const defaultQPS = 5
+
+func requestsPerSecond() float64 {
+	switch {
+	case qps > 0:
+		return qps
+	case prof != nil && prof.QPS > 0:
+		return prof.QPS
+	}
+	return defaultQPS
+}
+
+// rateLimiter spaces requests out so that there are no more than
+// requestsPerSecond of them, whichever goroutine sends them.
+type rateLimiter struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+func (l *rateLimiter) wait(req *http.Request) error {
+	every := time.Duration(float64(time.Second) / requestsPerSecond())
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(every)
+	l.mu.Unlock()
+	select {
+	case <-time.After(time.Until(at)):
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+// maxRetries is how many times a request refused for going over the
+// quota is sent again.
+const maxRetries = 4
+
+// rateLimitTransport sends requests through the limiter, and sends
+// reads that were refused for going too fast again after backing off.
+type rateLimitTransport struct {
+	limiter *rateLimiter
+	next    http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	backoff := time.Second
+	for try := 0; ; try++ {
+		if err := t.limiter.wait(req); err != nil {
+			return nil, err
+		}
+		resp, err := t.next.RoundTrip(req)
+		if err != nil || req.Method != http.MethodGet || try == maxRetries || !tooFast(resp) {
+			return resp, err
+		}
+		delay := backoff
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			delay = time.Duration(secs) * time.Second
+		}
+		resp.Body.Close()
+		log.Debugf("%s: over quota, trying again in %v", req.URL.Host, delay)
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		backoff *= 2
+	}
+}
+
+// tooFast tells whether the server refused the request for going over
+// the quota: 429, or Google's 403 with a rate limit reason.
+func tooFast(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusForbidden:
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return err == nil && bytes.Contains(body, []byte("ateLimitExceeded"))
+	}
+	return false
+}
+
+// A statusError is an HTTP response with a status we didn't expect.
+type statusError struct {
+	code int
+	text string
+}
+
+func (e *statusError) Error() string { return e.text }
+
+// inaccessible tells the calendars we may no longer read, or that are
+// gone, such as shared calendars we were unsubscribed from: those
+// answer 403 or 404, and trying again won't help.
+func inaccessible(err error) bool {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		for _, item := range gerr.Errors {
+			if strings.Contains(item.Reason, "ateLimitExceeded") {
+				return false
+			}
+		}
+		return gerr.Code == http.StatusForbidden || gerr.Code == http.StatusNotFound
+	}
+	var serr *statusError
+	return errors.As(err, &serr) && (serr.code == http.StatusForbidden || serr.code == http.StatusNotFound)
+}
+
+// failedCalendars are the calendars that couldn't be read, by name, to
+// report at the end of the run rather than giving up on the others, and
+// skippedCalendars those that couldn't because they're inaccessible.
+var (
+	failedMu         sync.Mutex
+	failedCalendars  = map[string]error{}
+	skippedCalendars = map[string]error{}
+)
+
+func calendarFailed(name string, err error) {
+	log.Warningf("skipping calendar %s: %v", name, err)
+	failedMu.Lock()
+	if inaccessible(err) {
+		skippedCalendars[name] = err
+	} else {
+		failedCalendars[name] = err
+	}
+	failedMu.Unlock()
+}
+
+// someCalendarsFailed tells whether a calendar was skipped, without
+// reporting it.
+func someCalendarsFailed() bool {
+	failedMu.Lock()
+	defer failedMu.Unlock()
+	return len(failedCalendars) > 0 || len(skippedCalendars) > 0
+}
+
+func sortedNames(calendars map[string]error) []string {
+	names := make([]string, 0, len(calendars))
+	for name := range calendars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// calendarFailures sums up the calendars that couldn't be read, or is
+// nil if they all were. The inaccessible ones are only warned about,
+// as they will stay that way until the configuration leaves them out.
+func calendarFailures() error {
+	failedMu.Lock()
+	defer failedMu.Unlock()
+	if skipped := sortedNames(skippedCalendars); len(skipped) > 0 {
+		log.Warningf("skipped %s that can't be read any more: %s",
+			plural(len(skipped), "calendar"), strings.Join(skipped, ", "))
+	}
+	if len(failedCalendars) == 0 {
+		return nil
+	}
+	names := sortedNames(failedCalendars)
+	for _, name := range names {
+		log.Errorf("%s: %v", name, failedCalendars[name])
+	}
+	if len(names) == 1 {
+		return apiError("1 calendar could not be read")
+	}
+	return apiError("%d calendars could not be read", len(names))
+}
+
+// fatal tells the errors that would fail for every calendar, such as a
+// token that needs renewing, from those of a single calendar.
+func fatal(err error) bool {
+	var ee *exitError
+	return errors.As(err, &ee) && ee.code != exitAPI
+}
+
+// forEachCalendar calls fetch for each of n calendars, -parallel of them
+// at a time, and returns the errors by calendar.
+func forEachCalendar(n int, fetch func(i int) error) []error {
+	errs := make([]error, n)
+	sem := make(chan struct{}, max(parallel, 1))
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() { <-sem; wg.Done() }()
+			errs[i] = fetch(i)
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+var (
+	blockTitle string
+	blockMin   time.Duration
+	blockDays  int
+	blockInto  string
+	blockApply bool
+)
+
+func init() {
+	register(&command{
+		name:    "block",
+		summary: "Fill the free time left in the working day with focus time events",
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&blockTitle, "title", "Focus", "Summary of the events")
+			fs.DurationVar(&blockMin, "min", time.Hour, "Shortest free time worth blocking")
+			fs.IntVar(&blockDays, "days", 1, "Number of working days to cover")
+			fs.StringVar(&blockInto, "into", "primary", "Calendar to add the events to")
+			fs.BoolVar(&blockApply, "apply", false, "Create the events instead of listing them")
+		},
+		run: runBlock,
+	})
+}
+
+// blockEvent is the event that takes up a free interval.
+func blockEvent(iv interval) *calendar.Event {
+	return &calendar.Event{
+		Summary:      blockTitle,
+		Description:  "Blocked with gcal block.",
+		Start:        eventDateTime(iv.Start, false),
+		End:          eventDateTime(iv.End, false),
+		Transparency: "opaque",
+	}
+}
+
+func runBlock(args []string) error {
+	if len(args) != 0 {
+		return usageError("usage: gcal block")
+	}
+	if blockDays < 1 {
+		return usageError("-days must be at least 1")
+	}
+	if blockMin <= 0 {
+		return usageError("-min must be positive")
+	}
+	if blockApply {
+		if prof.Provider != "google" {
+			return usageError("adding events is only available with Google")
+		}
+		scopes = append(scopes, calendar.CalendarEventsScope)
+	}
+	ctx := context.Background()
+	free, err := workingFreeTimes(ctx, blockDays, blockMin)
+	if err != nil {
+		return err
+	}
+	if len(free) == 0 {
+		log.Warningf("no free time of %v or more left in the next %d working days", blockMin, blockDays)
+		return nil
+	}
+	var w writer
+	if blockApply {
+		p, err := newProvider(ctx)
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if w, ok = p.(writer); !ok {
+			return usageError("the %s provider can't add events", prof.Provider)
+		}
+	}
+	for _, iv := range free {
+		fmt.Printf("%s %s–%s  %s\n", localDate(iv.Start, "Mon Jan 02"),
+			iv.Start.Format("15:04"), iv.End.Format("15:04"), blockTitle)
+		if !blockApply {
+			continue
+		}
+		if _, err := w.Insert(ctx, blockInto, blockEvent(iv)); err != nil {
+			return err
+		}
+	}
+	if !blockApply {
+		log.Infof("Run gcal block -apply to add them to %s", blockInto)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+var buffer time.Duration
+
+func init() {
+	flag.DurationVar(&buffer, "buffer", 0, "Block this long before events with a physical location, for travel or preparation (e.g. 15m)")
+}
+
+// virtualLocations are locations people give calls that aren't places.
+var virtualLocations = map[string]bool{
+	"zoom":                    true,
+	"google meet":             true,
+	"microsoft teams meeting": true,
+	"microsoft teams":         true,
+	"teams":                   true,
+	"webex":                   true,
+	"online":                  true,
+	"virtual":                 true,
+	"phone":                   true,
+	"call":                    true,
+}
+
+// physicalLocation tells whether the event happens somewhere one has to
+// get to, rather than on a call.
+func physicalLocation(location string) bool {
+	location = strings.TrimSpace(location)
+	lower := strings.ToLower(location)
+	return location != "" && !virtualLocations[lower] && !meetingURL.MatchString(location) &&
+		!strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://")
+}
+
+// bufferFor is how long to block before the event: its calendar's
+// buffer, or -buffer. Only timed events we're going to, somewhere, get
+// one.
+func bufferFor(ev *agendaEvent) time.Duration {
+	if ev.AllDay || ev.Task || ev.Buffer || len(ev.Recurrence) > 0 || ev.Transparency == "transparent" ||
+		responseStatus(ev) == "declined" || !physicalLocation(ev.Location) {
+		return 0
+	}
+	if ev.Settings.Buffer != "" {
+		// Checked when loading the configuration.
+		d, _ := time.ParseDuration(ev.Settings.Buffer)
+		return d
+	}
+	return buffer
+}
+
+// addBuffers adds a travel/prep block before every event that needs one.
+// The blocks are busy, and private if their event is, so that they show
+// up in free/busy and are masked like their event.
+func addBuffers(events []*agendaEvent) []*agendaEvent {
+	withBuffers := make([]*agendaEvent, 0, len(events))
+	for _, ev := range events {
+		d := bufferFor(ev)
+		if d <= 0 {
+			withBuffers = append(withBuffers, ev)
+			continue
+		}
+		start := ev.Start.Add(-d)
+		block := &agendaEvent{
+			Event: &calendar.Event{
+				Id:         ev.Id + "_buffer",
+				Summary:    "Travel/prep: " + strings.TrimSpace(ev.Summary),
+				Location:   ev.Location,
+				Start:      &calendar.EventDateTime{DateTime: start.Format(time.RFC3339)},
+				End:        ev.Event.Start,
+				Status:     "confirmed",
+				Visibility: ev.Visibility,
+			},
+			Calendar:   ev.Calendar,
+			CalendarID: ev.CalendarID,
+			Provider:   ev.Provider,
+			Settings:   ev.Settings,
+			Start:      start,
+			End:        ev.Start,
+			Demoted:    ev.Demoted,
+			Buffer:     true,
+		}
+		withBuffers = append(withBuffers, block, ev)
+	}
+	return withBuffers
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+var (
+	calendarTTL      time.Duration
+	refreshCalendars bool
+)
+
+func init() {
+	flag.DurationVar(&calendarTTL, "calendar-ttl", 24*time.Hour, "How long to reuse the cached calendar list (0 to always fetch it)")
+	flag.BoolVar(&refreshCalendars, "refresh-calendars", false, "Fetch the calendar list again even if the cached one is recent")
+}
+
+// cachePath returns the path of a file in gcal's cache directory.
+func cachePath(name string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gcal", name), nil
+}
+
+// calendarList is the cached calendar list of a profile, with everything
+// the provider gave us about the calendars. Shell completion offers
+// their names without talking to the provider.
+type calendarList struct {
+	Fetched   time.Time                     `json:"fetched"`
+	Provider  string                        `json:"provider"`
+	Calendars []*calendar.CalendarListEntry `json:"calendars"`
+	// Feeds are the calendars of the iCalendar feeds. They are only
+	// for completion, as they are read along with the feeds.
+	Feeds []*calendar.CalendarListEntry `json:"feeds,omitempty"`
+}
+
+func calendarListPath() (string, error) {
+	return cachePath("calendarlist-" + sanitizeFilename(profilename) + ".json")
+}
+
+// loadCalendarList returns the profile's cached calendar list, which is
+// empty if there is none yet.
+func loadCalendarList() (*calendarList, string, error) {
+	path, err := calendarListPath()
+	if err != nil {
+		return nil, "", err
+	}
+	cached := &calendarList{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cached, path, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if err := json.Unmarshal(b, cached); err != nil {
+		// A broken cache is as good as none.
+		return &calendarList{}, path, nil
+	}
+	return cached, path, nil
+}
+
+func (l *calendarList) save(path string) error {
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return mutate("cache the calendar list in "+path, func() error {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		return os.WriteFile(path, b, 0600)
+	})
+}
+
+// cachedCalendars returns the provider's calendars, from the cache if it
+// was filled less than -calendar-ttl ago, so that runs from cron don't
+// ask for a list that hardly ever changes.
+func cachedCalendars(ctx context.Context, p provider) ([]*calendar.CalendarListEntry, error) {
+	cached, path, err := loadCalendarList()
+	if err != nil {
+		return nil, err
+	}
+	if calendarTTL > 0 && !refreshCalendars && cached.Provider == prof.Provider &&
+		time.Since(cached.Fetched) < calendarTTL {
+		log.Debugf("Using the calendar list cached in %s", path)
+		return cached.Calendars, nil
+	}
+	list, err := p.Calendars(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cached.Fetched, cached.Provider, cached.Calendars = time.Now(), prof.Provider, list
+	if err := cached.save(path); err != nil {
+		log.Warningf("unable to cache calendar list: %v", err)
+	}
+	return list, nil
+}
+
+// rememberFeeds keeps the calendars of the iCalendar feeds in the cache
+// for completion, if they changed.
+func rememberFeeds(feeds []*calendar.CalendarListEntry) error {
+	cached, path, err := loadCalendarList()
+	if err != nil {
+		return err
+	}
+	old, _ := json.Marshal(cached.Feeds)
+	now, _ := json.Marshal(feeds)
+	if bytes.Equal(old, now) || (len(cached.Feeds) == 0 && len(feeds) == 0) {
+		return nil
+	}
+	cached.Feeds = feeds
+	return cached.save(path)
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// caldavConfig is the caldav section of a profile.
+type caldavConfig struct {
+	// URL is the server's DAV root, e.g.
+	// https://cloud.example.com/remote.php/dav for Nextcloud.
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	// Password may be left out in favour of $GCAL_CALDAV_PASSWORD.
+	Password string `json:"password"`
+	// Auth is basic (the default) or digest.
+	Auth string `json:"auth"`
+}
+
+// caldavProvider reads calendars from a CalDAV server (RFC 4791), such
+// as Nextcloud, Fastmail or Radicale.
+type caldavProvider struct {
+	base   *url.URL
+	client *http.Client
+	conf   *caldavConfig
+}
+
+func newCalDAVProvider(ctx context.Context) (provider, error) {
+	conf := prof.CalDAV
+	if conf == nil || conf.URL == "" {
+		return nil, usageError("profile %q needs caldav.url to use the caldav provider", profilename)
+	}
+	base, err := url.Parse(conf.URL)
+	if err != nil {
+		return nil, usageError("bad caldav url: %v", err)
+	}
+	if conf.Password == "" {
+		conf.Password = os.Getenv("GCAL_CALDAV_PASSWORD")
+	}
+	client := httpClient(0)
+	switch conf.Auth {
+	case "", "basic":
+	case "digest":
+		client.Transport = &digestTransport{username: conf.Username, password: conf.Password, next: baseTransport}
+	default:
+		return nil, usageError("unsupported caldav auth: %s", conf.Auth)
+	}
+	return &caldavProvider{base, client, conf}, nil
+}
+
+const (
+	davNS    = "DAV:"
+	caldavNS = "urn:ietf:params:xml:ns:caldav"
+)
+
+type davHref struct {
+	Href string `xml:"DAV: href"`
+}
+
+type davProp struct {
+	CurrentUserPrincipal davHref `xml:"DAV: current-user-principal"`
+	CalendarHomeSet      davHref `xml:"urn:ietf:params:xml:ns:caldav calendar-home-set"`
+	DisplayName          string  `xml:"DAV: displayname"`
+	ResourceType         struct {
+		Calendar *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar"`
+	} `xml:"DAV: resourcetype"`
+	CalendarDescription string `xml:"urn:ietf:params:xml:ns:caldav calendar-description"`
+	ComponentSet        struct {
+		Comp []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"urn:ietf:params:xml:ns:caldav comp"`
+	} `xml:"urn:ietf:params:xml:ns:caldav supported-calendar-component-set"`
+	CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+}
+
+type davResponse struct {
+	Href     string `xml:"DAV: href"`
+	Propstat []struct {
+		Prop   davProp `xml:"DAV: prop"`
+		Status string  `xml:"DAV: status"`
+	} `xml:"DAV: propstat"`
+}
+
+// prop returns the properties the server found for the resource.
+func (r *davResponse) prop() *davProp {
+	for _, ps := range r.Propstat {
+		if strings.Contains(ps.Status, " 200 ") {
+			return &ps.Prop
+		}
+	}
+	return &davProp{}
+}
+
+type davMultistatus struct {
+	Responses []davResponse `xml:"DAV: response"`
+}
+
+// request sends a PROPFIND or REPORT and parses the multistatus reply.
+func (c *caldavProvider) request(ctx context.Context, method, path, depth, body string) (*davMultistatus, error) {
+	u, err := c.base.Parse(path)
+	if err != nil {
+		return nil, apiError("bad href %q: %v", path, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("Depth", depth)
+	if c.conf.Auth == "" || c.conf.Auth == "basic" {
+		req.SetBasicAuth(c.conf.Username, c.conf.Password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, apiError("%s %s: %v", method, u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, authError("%s %s: %s", method, u, resp.Status)
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, apiError("%s %s: %w", method, u, &statusError{resp.StatusCode, resp.Status})
+	}
+	ms := &davMultistatus{}
+	if err := xml.NewDecoder(resp.Body).Decode(ms); err != nil {
+		return nil, apiError("%s %s: bad response: %v", method, u, err)
+	}
+	return ms, nil
+}
+
+// propfind asks for the named properties of a resource and returns the
+// first response.
+func (c *caldavProvider) propfind(ctx context.Context, path, props string) (*davProp, error) {
+	body := `<?xml version="1.0" encoding="utf-8"?>` +
+		`<D:propfind xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav"><D:prop>` +
+		props + `</D:prop></D:propfind>`
+	ms, err := c.request(ctx, "PROPFIND", path, "0", body)
+	if err != nil {
+		return nil, err
+	}
+	if len(ms.Responses) == 0 {
+		return &davProp{}, nil
+	}
+	return ms.Responses[0].prop(), nil
+}
+
+// homeSet finds the collection holding the user's calendars, going from
+// the DAV root to the principal to its calendar home (RFC 4791 6.2.1).
+func (c *caldavProvider) homeSet(ctx context.Context) (string, error) {
+	path := c.base.Path
+	prop, err := c.propfind(ctx, path, "<D:current-user-principal/>")
+	if err != nil {
+		return "", err
+	}
+	if principal := prop.CurrentUserPrincipal.Href; principal != "" {
+		path = principal
+	}
+	prop, err = c.propfind(ctx, path, "<C:calendar-home-set/>")
+	if err != nil {
+		return "", err
+	}
+	if home := prop.CalendarHomeSet.Href; home != "" {
+		return home, nil
+	}
+	// Not much of a server; hope the calendars are right here.
+	log.Debugf("no calendar-home-set found, listing %s", path)
+	return path, nil
+}
+
+func (c *caldavProvider) Calendars(ctx context.Context) ([]*calendar.CalendarListEntry, error) {
+	home, err := c.homeSet(ctx)
+	if err != nil {
+		return nil, err
+	}
+	body := `<?xml version="1.0" encoding="utf-8"?>` +
+		`<D:propfind xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav"><D:prop>` +
+		`<D:resourcetype/><D:displayname/><C:calendar-description/>` +
+		`<C:supported-calendar-component-set/></D:prop></D:propfind>`
+	ms, err := c.request(ctx, "PROPFIND", home, "1", body)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*calendar.CalendarListEntry, 0)
+	for _, r := range ms.Responses {
+		prop := r.prop()
+		if prop.ResourceType.Calendar == nil || !supportsEvents(prop) {
+			continue
+		}
+		name := strings.TrimSpace(prop.DisplayName)
+		desc := strings.TrimSpace(prop.CalendarDescription)
+		if desc == "" {
+			// gcal names calendars by their description.
+			desc = name
+		}
+		items = append(items, &calendar.CalendarListEntry{
+			Id:          r.Href,
+			Summary:     name,
+			Description: desc,
+		})
+	}
+	return items, nil
+}
+
+// supportsEvents tells apart calendars that hold events from the ones
+// that only hold tasks. No component set means anything goes.
+func supportsEvents(prop *davProp) bool {
+	if len(prop.ComponentSet.Comp) == 0 {
+		return true
+	}
+	for _, comp := range prop.ComponentSet.Comp {
+		if strings.EqualFold(comp.Name, "VEVENT") {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *caldavProvider) Events(ctx context.Context, calid string, start, end time.Time) ([]*calendar.Event, error) {
+	const layout = "20060102T150405Z"
+	timerange := fmt.Sprintf(`start="%s" end="%s"`, start.UTC().Format(layout), end.UTC().Format(layout))
+	// Ask the server to expand recurring events into their instances.
+	body := `<?xml version="1.0" encoding="utf-8"?>` +
+		`<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">` +
+		`<D:prop><C:calendar-data><C:expand ` + timerange + `/></C:calendar-data></D:prop>` +
+		`<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT">` +
+		`<C:time-range ` + timerange + `/>` +
+		`</C:comp-filter></C:comp-filter></C:filter></C:calendar-query>`
+	ms, err := c.request(ctx, "REPORT", calid, "1", body)
+	if err != nil {
+		return nil, err
+	}
+	localzone, err := localZone()
+	if err != nil {
+		return nil, err
+	}
+	events := make([]*calendar.Event, 0)
+	for _, r := range ms.Responses {
+		data := r.prop().CalendarData
+		if data == "" {
+			continue
+		}
+		cal, err := parseICS(strings.NewReader(data), localzone)
+		if err != nil {
+			return nil, apiError("%s: %v", r.Href, err)
+		}
+		events = append(events, cal.Events...)
+	}
+	// Not every server does expand, so make sure.
+	return eventsInWindow(events, start, end, localzone)
+}
+
+// digestTransport answers HTTP digest authentication challenges (RFC
+// 7616), which some CalDAV servers insist on. Every request is first sent
+// without credentials to get a fresh challenge.
+type digestTransport struct {
+	username string
+	password string
+	next     http.RoundTripper
+}
+
+func (t *digestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	first := req.Clone(req.Context())
+	first.Body = io.NopCloser(bytes.NewReader(body))
+	resp, err := t.next.RoundTrip(first)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	if !strings.HasPrefix(strings.ToLower(challenge), "digest ") {
+		return resp, nil
+	}
+	resp.Body.Close()
+	authz, err := t.authorization(req.Method, req.URL.RequestURI(), challenge[len("digest "):])
+	if err != nil {
+		return nil, err
+	}
+	second := req.Clone(req.Context())
+	second.Body = io.NopCloser(bytes.NewReader(body))
+	second.Header.Set("Authorization", authz)
+	return t.next.RoundTrip(second)
+}
+
+// parseAuthParams splits the comma separated key=value pairs of an
+// authentication challenge.
+func parseAuthParams(s string) map[string]string {
+	params := map[string]string{}
+	for s != "" {
+		s = strings.TrimLeft(s, " ,")
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = s[eq+1:]
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			// A quoted string, in which a backslash escapes the next
+			// character.
+			var b strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			value = b.String()
+			s = s[min(i+1, len(s)):]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+		params[key] = value
+	}
+	return params
+}
+
+func md5hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func (t *digestTransport) authorization(method, uri, challenge string) (string, error) {
+	params := parseAuthParams(challenge)
+	if alg := params["algorithm"]; alg != "" && !strings.EqualFold(alg, "MD5") {
+		return "", authError("unsupported digest algorithm %s", alg)
+	}
+	realm, nonce := params["realm"], params["nonce"]
+	ha1 := md5hex(t.username + ":" + realm + ":" + t.password)
+	ha2 := md5hex(method + ":" + uri)
+	authz := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s"`,
+		t.username, realm, nonce, uri)
+	if strings.Contains(params["qop"], "auth") {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		cnonce := hex.EncodeToString(b)
+		const nc = "00000001"
+		response := md5hex(strings.Join([]string{ha1, nonce, nc, cnonce, "auth", ha2}, ":"))
+		authz += fmt.Sprintf(`, qop=auth, nc=%s, cnonce="%s", response="%s"`, nc, cnonce, response)
+	} else {
+		authz += fmt.Sprintf(`, response="%s"`, md5hex(ha1+":"+nonce+":"+ha2))
+	}
+	if opaque, ok := params["opaque"]; ok {
+		authz += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+	if _, ok := params["algorithm"]; ok {
+		authz += ", algorithm=MD5"
+	}
+	return authz, nil
+}
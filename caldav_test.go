@@ -0,0 +1,29 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAuthParams(t *testing.T) {
+	tests := []struct {
+		s    string
+		want map[string]string
+	}{
+		{`realm="testrealm@host.com", qop="auth,auth-int", nonce="dcd98b7102dd2f0e", opaque="5ccc069c403ebaf9"`,
+			map[string]string{"realm": "testrealm@host.com", "qop": "auth,auth-int", "nonce": "dcd98b7102dd2f0e", "opaque": "5ccc069c403ebaf9"}},
+		{`Realm=Radicale,algorithm=MD5, stale=TRUE`,
+			map[string]string{"realm": "Radicale", "algorithm": "MD5", "stale": "TRUE"}},
+		{`realm="a \"b\"", nonce=x`, map[string]string{"realm": `a "b"`, "nonce": "x"}},
+		{`realm="unterminated`, map[string]string{"realm": "unterminated"}},
+		{`realm=""`, map[string]string{"realm": ""}},
+		{`, , realm=x ,`, map[string]string{"realm": "x"}},
+		{``, map[string]string{}},
+		{`no pairs here`, map[string]string{}},
+	}
+	for _, tt := range tests {
+		if got := parseAuthParams(tt.s); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseAuthParams(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
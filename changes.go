@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+var (
+	diffJSON     bool
+	diffSnapshot string
+)
+
+func init() {
+	register(&command{
+		name:    "diff",
+		summary: "Print the events added, cancelled or moved since the last diff",
+		flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&diffJSON, "json", false, "Print the changes as JSON")
+			fs.StringVar(&diffSnapshot, "snapshot", "", "File to keep the snapshot in (default: one per profile in the cache directory)")
+		},
+		run: runDiff,
+	})
+}
+
+// snapshotEvent is what the snapshot remembers of an event.
+type snapshotEvent struct {
+	ID       string    `json:"id"`
+	Summary  string    `json:"summary"`
+	Calendar string    `json:"calendar"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	AllDay   bool      `json:"all_day"`
+}
+
+// snapshot is the schedule as of the last diff.
+type snapshot struct {
+	Taken time.Time `json:"taken"`
+	// WindowEnd is the end of the window it was taken for. Events
+	// starting later were not looked at, so they aren't new.
+	WindowEnd time.Time        `json:"window_end"`
+	Events    []*snapshotEvent `json:"events"`
+}
+
+// moved is an event that changed time.
+type moved struct {
+	Old *snapshotEvent `json:"old"`
+	New *snapshotEvent `json:"new"`
+}
+
+type changes struct {
+	New         []*snapshotEvent `json:"new"`
+	Cancelled   []*snapshotEvent `json:"cancelled"`
+	Rescheduled []*moved         `json:"rescheduled"`
+}
+
+func snapshotPath() (string, error) {
+	if diffSnapshot != "" {
+		return diffSnapshot, nil
+	}
+	return cachePath("snapshot-" + sanitizeFilename(profilename) + ".json")
+}
+
+// loadSnapshot reads the snapshot, or returns nil if there is none yet.
+func loadSnapshot(path string) (*snapshot, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	snap := &snapshot{}
+	if err := json.Unmarshal(b, snap); err != nil {
+		return nil, fmt.Errorf("unable to parse snapshot %s: %v", path, err)
+	}
+	return snap, nil
+}
+
+func saveSnapshot(path string, snap *snapshot) error {
+	b, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	return mutate("save the snapshot in "+path, func() error {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		return os.WriteFile(path, b, 0600)
+	})
+}
+
+func takeSnapshot(now, end time.Time, events []*agendaEvent) *snapshot {
+	snap := &snapshot{Taken: now, WindowEnd: end, Events: make([]*snapshotEvent, 0, len(events))}
+	for _, ev := range sortedByStart(events) {
+		snap.Events = append(snap.Events, &snapshotEvent{
+			ID:       ev.StableID(),
+			Summary:  summary(ev),
+			Calendar: ev.Calendar,
+			Start:    ev.Start,
+			End:      ev.End,
+			AllDay:   ev.AllDay,
+		})
+	}
+	return snap
+}
+
+// compareSnapshots finds what changed from old to cur, which was taken
+// for the window [start, cur.WindowEnd). Only the part of the schedule
+// both looked at counts: events that left the window as time went by
+// weren't cancelled, and events that came into it aren't new.
+func compareSnapshots(old, cur *snapshot, start time.Time) *changes {
+	c := &changes{
+		New:         make([]*snapshotEvent, 0),
+		Cancelled:   make([]*snapshotEvent, 0),
+		Rescheduled: make([]*moved, 0),
+	}
+	before := map[string]*snapshotEvent{}
+	for _, ev := range old.Events {
+		before[ev.ID] = ev
+	}
+	seen := map[string]bool{}
+	for _, ev := range cur.Events {
+		seen[ev.ID] = true
+		was, ok := before[ev.ID]
+		switch {
+		case !ok && ev.Start.Before(old.WindowEnd):
+			c.New = append(c.New, ev)
+		case ok && (!was.Start.Equal(ev.Start) || !was.End.Equal(ev.End)):
+			c.Rescheduled = append(c.Rescheduled, &moved{was, ev})
+		}
+	}
+	for _, ev := range old.Events {
+		if !seen[ev.ID] && !ev.Start.Before(start) && ev.Start.Before(cur.WindowEnd) {
+			c.Cancelled = append(c.Cancelled, ev)
+		}
+	}
+	sort.SliceStable(c.Cancelled, func(i, j int) bool {
+		return c.Cancelled[i].Start.Before(c.Cancelled[j].Start)
+	})
+	return c
+}
+
+// when is the event's time, as in the agenda.
+func (ev *snapshotEvent) when() string {
+	if ev.AllDay {
+		return ev.Start.Format("Mon Jan 02") + " all day"
+	}
+	return ev.Start.Format("Mon Jan 02 15:04") + "-" + ev.End.Format("15:04")
+}
+
+func (ev *snapshotEvent) String() string {
+	s := ev.Summary
+	if ev.Calendar != "" {
+		s += " [" + ev.Calendar + "]"
+	}
+	return s
+}
+
+func printChanges(w io.Writer, c *changes) {
+	if len(c.New) > 0 {
+		fmt.Fprintln(w, "New:")
+		for _, ev := range c.New {
+			fmt.Fprintf(w, "  %-22s %s\n", ev.when(), ev)
+		}
+	}
+	if len(c.Cancelled) > 0 {
+		fmt.Fprintln(w, "Cancelled:")
+		for _, ev := range c.Cancelled {
+			fmt.Fprintf(w, "  %-22s %s\n", ev.when(), ev)
+		}
+	}
+	if len(c.Rescheduled) > 0 {
+		fmt.Fprintln(w, "Rescheduled:")
+		for _, m := range c.Rescheduled {
+			fmt.Fprintf(w, "  %-22s %s\n  %-22s (was %s)\n", m.New.when(), m.New, "", m.Old.when())
+		}
+	}
+}
+
+func runDiff(args []string) error {
+	if _, err := parseFilters(); err != nil {
+		return err
+	}
+	localzone, err := localZone()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	start, end, err := agendaWindow(now.Local(), duration)
+	if err != nil {
+		return err
+	}
+	path, err := snapshotPath()
+	if err != nil {
+		return err
+	}
+	old, err := loadSnapshot(path)
+	if err != nil {
+		return err
+	}
+	events, _, err := agendaEvents(context.Background(), duration, localzone)
+	if err != nil {
+		return err
+	}
+	if someCalendarsFailed() {
+		// Their events would all look cancelled, and then added again
+		// next time.
+		log.Warningf("not comparing with or saving the snapshot, as some calendars couldn't be read")
+		return nil
+	}
+	cur := takeSnapshot(now, end, events)
+	if old == nil {
+		// Nothing to compare with: this is the starting point.
+		log.Infof("No snapshot yet; saving one in %s", path)
+		return saveSnapshot(path, cur)
+	}
+	c := compareSnapshots(old, cur, start)
+	if diffJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(c); err != nil {
+			return err
+		}
+	} else {
+		printChanges(os.Stdout, c)
+	}
+	return saveSnapshot(path, cur)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// A command is a gcal subcommand, e.g. "gcal completion bash". Running
+// gcal without one prints the agenda.
+type command struct {
+	name    string
+	args    string // synopsis of the positional arguments
+	summary string
+	// flags registers the command's own flags; the global ones are
+	// always accepted as well.
+	flags func(fs *flag.FlagSet)
+	// complete lists the values the first positional argument can take,
+	// for shell completion.
+	complete []string
+	// anyConfig runs the command even when the configuration doesn't
+	// load, for it to say why.
+	anyConfig bool
+	run       func(args []string) error
+}
+
+var commands = map[string]*command{}
+
+func register(cmd *command) {
+	commands[cmd.name] = cmd
+}
+
+// hidden commands are for gcal's own use and not listed anywhere.
+func (cmd *command) hidden() bool {
+	return strings.HasPrefix(cmd.name, "__")
+}
+
+// commandNames returns the sorted names of the visible commands.
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name, cmd := range commands {
+		if !cmd.hidden() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// flagSet returns a flag set holding the command's flags followed by the
+// global ones, so that "gcal -debug stats" and "gcal stats -debug" both
+// work.
+func (cmd *command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("gcal "+cmd.name, flag.ContinueOnError)
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		if fs.Lookup(f.Name) == nil {
+			fs.Var(f.Value, f.Name, f.Usage)
+			fs.Lookup(f.Name).DefValue = f.DefValue
+		}
+	})
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: gcal [flags] %s [flags] %s\n\n%s\n\nFlags:\n",
+			cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// runCommand runs the command named by args[0] with the rest of args.
+func runCommand(args []string) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		flag.Usage()
+		return usageError("unknown command: %s", args[0])
+	}
+	fs := cmd.flagSet()
+	if err := fs.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return &exitError{exitUsage, err}
+	}
+	if err := setupLogging(); err != nil {
+		return err
+	}
+	if err := loadConfig(); err != nil {
+		if !cmd.anyConfig {
+			return err
+		}
+		prof = nil
+	}
+	if err := setupTransport(); err != nil {
+		return err
+	}
+	if err := loadLocale(); err != nil {
+		return err
+	}
+	return cmd.run(fs.Args())
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: gcal [flags] [command]\n\nCommands:\n")
+	for _, name := range commandNames() {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nWithout a command, print the events in the window.\n\nFlags:\n")
+	flag.PrintDefaults()
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+func init() {
+	register(&command{
+		name:     "completion",
+		args:     "bash|zsh|fish",
+		summary:  "Print a shell completion script",
+		complete: []string{"bash", "zsh", "fish"},
+		run:      runCompletion,
+	})
+	register(&command{
+		name:    "__complete",
+		args:    "calendars",
+		summary: "List completion candidates, for the completion scripts",
+		run:     runComplete,
+	})
+}
+
+// flagValues lists the values worth offering for flags that take one of
+// a fixed set of values.
+func flagValues() map[string][]string {
+	formats := make([]string, 0, len(formatters))
+	for name := range formatters {
+		formats = append(formats, name)
+	}
+	sort.Strings(formats)
+	languages := []string{"en"}
+	for lang := range locales {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	return map[string][]string{
+		"format":        formats,
+		"color":         {"auto", "always", "never"},
+		"duration":      {"1d", "1w", "1m", "1y"},
+		"log-format":    {"text", "json"},
+		"org-style":     {"flat", "weektree"},
+		"remind-clock":  {"12", "24"},
+		"remind-date":   {"short", "full", "iso"},
+		"remind-weekly": {"weekday", "repeat"},
+		"outside-hours": {"drop", "demote"},
+		"private":       {"auto", "mask", "show"},
+		"action":        {"details", "link", "copy", "open"},
+		"weekdays":      {"mon-fri", "sat-sun"},
+		"locale":        languages,
+	}
+}
+
+// dynamicFlags are flags whose values are looked up by running
+// "gcal __complete <flag>".
+var dynamicFlags = map[string]string{
+	"calendar": "calendars",
+}
+
+// fileFlags are flags that take a file name.
+var fileFlags = map[string]bool{
+	"ca-cert":    true,
+	"config":     true,
+	"dir":        true,
+	"ics-file":   true,
+	"output-dir": true,
+	"token-key":  true,
+}
+
+type completionFlag struct {
+	Name    string
+	Usage   string
+	Bool    bool
+	Values  []string
+	Dynamic string
+	Files   bool
+}
+
+type completionCommand struct {
+	Name    string
+	Summary string
+	Args    []string
+	Flags   []completionFlag
+}
+
+type completionData struct {
+	Commands []completionCommand
+	Flags    []completionFlag
+	// AllFlags are the global flags and those of every command.
+	AllFlags []completionFlag
+}
+
+func completionFlags(fs *flag.FlagSet) []completionFlag {
+	values := flagValues()
+	flags := make([]completionFlag, 0)
+	fs.VisitAll(func(f *flag.Flag) {
+		cf := completionFlag{
+			Name:    f.Name,
+			Usage:   f.Usage,
+			Values:  values[f.Name],
+			Dynamic: dynamicFlags[f.Name],
+			Files:   fileFlags[f.Name],
+		}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok {
+			cf.Bool = b.IsBoolFlag()
+		}
+		flags = append(flags, cf)
+	})
+	return flags
+}
+
+func newCompletionData() completionData {
+	data := completionData{Flags: completionFlags(flag.CommandLine)}
+	for _, name := range commandNames() {
+		cmd := commands[name]
+		cc := completionCommand{Name: name, Summary: cmd.summary, Args: cmd.complete}
+		if cmd.flags != nil {
+			fs := flag.NewFlagSet(name, flag.ContinueOnError)
+			cmd.flags(fs)
+			cc.Flags = completionFlags(fs)
+		}
+		data.Commands = append(data.Commands, cc)
+	}
+	seen := map[string]bool{}
+	for _, flags := range append([][]completionFlag{data.Flags}, commandFlags(data.Commands)...) {
+		for _, f := range flags {
+			if !seen[f.Name] {
+				seen[f.Name] = true
+				data.AllFlags = append(data.AllFlags, f)
+			}
+		}
+	}
+	return data
+}
+
+func commandFlags(cmds []completionCommand) [][]completionFlag {
+	flags := make([][]completionFlag, 0, len(cmds))
+	for _, cmd := range cmds {
+		flags = append(flags, cmd.Flags)
+	}
+	return flags
+}
+
+var completionFuncs = template.FuncMap{
+	"join": strings.Join,
+	// quote escapes s for use inside single quotes in all three shells.
+	"quote": func(s string) string {
+		return strings.ReplaceAll(s, "'", `'\''`)
+	},
+}
+
+var bashCompletion = `# bash completion for gcal
+# eval "$(gcal completion bash)"
+_gcal() {
+    local cur prev cmd w i profile=default
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+    for ((i = 1; i < COMP_CWORD - 1; i++)); do
+        case "${COMP_WORDS[i]}" in -profile|--profile) profile="${COMP_WORDS[i+1]}" ;; esac
+    done
+    for w in "${COMP_WORDS[@]:1:COMP_CWORD-1}"; do
+        case "$w" in
+{{- range .Commands}}
+        {{.Name}}) cmd="$w"; break ;;
+{{- end}}
+        esac
+    done
+    case "$prev" in
+{{- range .AllFlags}}{{if .Values}}
+    -{{.Name}}|--{{.Name}}) COMPREPLY=($(compgen -W '{{join .Values " "}}' -- "$cur")); return ;;
+{{- else if .Dynamic}}
+    -{{.Name}}|--{{.Name}})
+        local IFS=$'\n'
+        COMPREPLY=($(compgen -W "$(gcal -profile "$profile" __complete {{.Dynamic}} 2>/dev/null)" -- "$cur"))
+        return ;;
+{{- else if .Files}}
+    -{{.Name}}|--{{.Name}}) COMPREPLY=($(compgen -f -- "$cur")); return ;;
+{{- end}}{{end}}
+    esac
+    if [[ "$cur" == -* ]]; then
+        local flags='{{range .Flags}}--{{.Name}} {{end}}'
+        case "$cmd" in
+{{- range .Commands}}{{if .Flags}}
+        {{.Name}}) flags="$flags {{range .Flags}}--{{.Name}} {{end}}" ;;
+{{- end}}{{end}}
+        esac
+        COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+        return
+    fi
+    case "$cmd" in
+    "") COMPREPLY=($(compgen -W '{{range .Commands}}{{.Name}} {{end}}' -- "$cur")) ;;
+{{- range .Commands}}{{if .Args}}
+    {{.Name}}) COMPREPLY=($(compgen -W '{{join .Args " "}}' -- "$cur")) ;;
+{{- end}}{{end}}
+    esac
+}
+complete -F _gcal gcal
+`
+
+var zshCompletion = `#compdef gcal
+# source <(gcal completion zsh)
+_gcal() {
+    local cmd w i profile=default prev=${words[CURRENT-1]} cur=${words[CURRENT]}
+    local -a cmds flags vals
+    for ((i = 2; i < CURRENT - 1; i++)); do
+        [[ $words[i] == (-|--)profile ]] && profile=$words[i+1]
+    done
+    cmds=({{range .Commands}}{{.Name}} {{end}})
+    for w in ${words[2,CURRENT-1]}; do
+        if (( ${cmds[(Ie)$w]} )); then cmd=$w; break; fi
+    done
+    case $prev in
+{{- range .AllFlags}}{{if .Values}}
+    -{{.Name}}|--{{.Name}}) compadd -- {{join .Values " "}}; return ;;
+{{- else if .Dynamic}}
+    -{{.Name}}|--{{.Name}}) vals=("${(@f)$(gcal -profile $profile __complete {{.Dynamic}} 2>/dev/null)}"); compadd -a vals; return ;;
+{{- else if .Files}}
+    -{{.Name}}|--{{.Name}}) _files; return ;;
+{{- end}}{{end}}
+    esac
+    if [[ $cur == -* ]]; then
+        flags=({{range .Flags}}--{{.Name}} {{end}})
+        case $cmd in
+{{- range .Commands}}{{if .Flags}}
+        {{.Name}}) flags+=({{range .Flags}}--{{.Name}} {{end}}) ;;
+{{- end}}{{end}}
+        esac
+        compadd -a flags
+        return
+    fi
+    case $cmd in
+    "") compadd -a cmds ;;
+{{- range .Commands}}{{if .Args}}
+    {{.Name}}) compadd -- {{join .Args " "}} ;;
+{{- end}}{{end}}
+    esac
+}
+compdef _gcal gcal
+`
+
+var fishCompletion = `# fish completion for gcal
+# gcal completion fish | source
+function __gcal_profile
+    set -l words (commandline -opc)
+    set -l profile default
+    for i in (seq (math (count $words) - 1))
+        if contains -- $words[$i] -profile --profile
+            set profile $words[(math $i + 1)]
+        end
+    end
+    echo $profile
+end
+complete -c gcal -f
+{{- range .Commands}}
+complete -c gcal -n '__fish_use_subcommand' -a {{.Name}} -d '{{quote .Summary}}'
+{{- if .Args}}
+complete -c gcal -n '__fish_seen_subcommand_from {{.Name}}' -a '{{join .Args " "}}'
+{{- end}}
+{{- $cmd := .Name}}{{range .Flags}}
+complete -c gcal -n '__fish_seen_subcommand_from {{$cmd}}' -l {{.Name}} -d '{{quote .Usage}}'{{if .Values}} -xa '{{join .Values " "}}'{{else if .Files}} -rF{{else if not .Bool}} -r{{end}}
+{{- end}}
+{{- end}}
+{{- range .Flags}}
+complete -c gcal -l {{.Name}} -d '{{quote .Usage}}'
+{{- if .Values}} -xa '{{join .Values " "}}'
+{{- else if .Dynamic}} -xa '(gcal -profile (__gcal_profile) __complete {{.Dynamic}} 2>/dev/null)'
+{{- else if .Files}} -rF
+{{- else if not .Bool}} -r{{end}}
+{{- end}}
+`
+
+var completionScripts = map[string]string{
+	"bash": bashCompletion,
+	"zsh":  zshCompletion,
+	"fish": fishCompletion,
+}
+
+func runCompletion(args []string) error {
+	if len(args) != 1 {
+		return usageError("usage: gcal completion bash|zsh|fish")
+	}
+	script, ok := completionScripts[args[0]]
+	if !ok {
+		return usageError("unsupported shell: %s", args[0])
+	}
+	t := template.Must(template.New(args[0]).Funcs(completionFuncs).Parse(script))
+	return t.Execute(os.Stdout, newCompletionData())
+}
+
+// runComplete prints completion candidates, one per line. It only ever
+// looks at local state, since it runs on every tab press.
+func runComplete(args []string) error {
+	if len(args) != 1 {
+		return usageError("usage: gcal __complete calendars")
+	}
+	switch args[0] {
+	case "calendars":
+		cached, _, err := loadCalendarList()
+		if err != nil {
+			return nil
+		}
+		// Without a cache yet, there is nothing to offer.
+		for _, cal := range append(cached.Calendars, cached.Feeds...) {
+			name := strings.TrimSpace(cal.Description)
+			if name == "" {
+				name = strings.TrimSpace(cal.Summary)
+			}
+			if name == "" {
+				name = cal.Id
+			}
+			fmt.Println(name)
+		}
+		return nil
+	}
+	return usageError("nothing to complete for %s", args[0])
+}
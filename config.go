@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// config is the optional configuration file. Everything in it has a
+// default, so gcal works without one.
+type config struct {
+	Profiles map[string]*profile `json:"profiles"`
+}
+
+// A profile is one account to read calendars from.
+type profile struct {
+	// Provider is the calendar service: google (the default), msgraph,
+	// caldav, or none.
+	Provider string `json:"provider"`
+	// Credentials is the Google client secret file.
+	Credentials string         `json:"credentials"`
+	Token       string         `json:"token"`
+	MSGraph     *msgraphConfig `json:"msgraph"`
+	CalDAV      *caldavConfig  `json:"caldav"`
+	// ICS lists iCalendar feeds to merge with the provider's calendars.
+	ICS []icsSource `json:"ics"`
+	// Primary makes -primary the default, unless -calendar is given.
+	Primary bool `json:"primary"`
+	// QPS is the most requests per second to send for the profile's
+	// account, unless -qps is given.
+	QPS float64 `json:"qps"`
+	// Email is our own address, to find our answers to invitations in
+	// events from providers that don't mark them.
+	Email string `json:"email"`
+	// Calendars holds per-calendar settings, keyed by calendar id or
+	// name.
+	Calendars map[string]*calendarConfig `json:"calendars"`
+	// Tags are the rules that tag events.
+	Tags []*tagRule `json:"tags"`
+}
+
+// calendarConfig overrides how one calendar is read and written.
+type calendarConfig struct {
+	// Include reads the calendar even though it has no name.
+	Include bool `json:"include"`
+	// Exclude skips the calendar, unless it is asked for with -calendar.
+	Exclude bool `json:"exclude"`
+	// Name replaces the calendar's name in the output.
+	Name string `json:"name"`
+	// Duration replaces -duration for this calendar.
+	Duration string `json:"duration"`
+	// Prefix is put in front of every event summary.
+	Prefix string `json:"prefix"`
+	// Priority is the remind PRIORITY of the calendar's reminders.
+	Priority int `json:"priority"`
+	// Category is the org CATEGORY of the calendar's entries.
+	Category string `json:"category"`
+	// File is where to write the calendar's events instead of stdout.
+	File string `json:"file"`
+	// Kind marks the calendar as birthdays or holidays, for calendars
+	// we cannot recognise by their id, such as iCalendar feeds.
+	Kind string `json:"kind"`
+	// Buffer replaces -buffer for this calendar's events.
+	Buffer string `json:"buffer"`
+}
+
+// check validates the settings that loading the configuration can't.
+func (settings *calendarConfig) check() error {
+	if settings.Duration != "" {
+		if _, _, err := window(time.Now(), settings.Duration); err != nil {
+			return err
+		}
+	}
+	if settings.Buffer != "" {
+		if _, err := time.ParseDuration(settings.Buffer); err != nil {
+			return fmt.Errorf("bad buffer: %v", err)
+		}
+	}
+	switch settings.Kind {
+	case "", kindBirthday, kindHoliday:
+	default:
+		return fmt.Errorf("unknown kind %q", settings.Kind)
+	}
+	return nil
+}
+
+// calendarSettings returns the configuration for a calendar, looked up
+// by id, then by description or summary. It is never nil.
+func calendarSettings(item *calendar.CalendarListEntry) *calendarConfig {
+	if prof == nil {
+		return &calendarConfig{}
+	}
+	if settings, ok := prof.Calendars[item.Id]; ok {
+		return settings
+	}
+	for key, settings := range prof.Calendars {
+		if strings.EqualFold(key, strings.TrimSpace(item.Description)) ||
+			strings.EqualFold(key, strings.TrimSpace(item.Summary)) {
+			return settings
+		}
+	}
+	return &calendarConfig{}
+}
+
+var (
+	configfile  string
+	profilename string
+	providerarg string
+
+	cfg  *config
+	prof *profile
+)
+
+func init() {
+	flag.StringVar(&configfile, "config", defaultConfigFile(), "Configuration file")
+	flag.StringVar(&profilename, "profile", "default", "Profile to use from the configuration file")
+	flag.StringVar(&providerarg, "provider", "", "Calendar provider (google|msgraph|caldav|none), overriding the profile")
+}
+
+func defaultConfigFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "gcal.json"
+	}
+	return filepath.Join(dir, "gcal", "config.json")
+}
+
+// loadConfig reads the configuration file, if there is one, and selects
+// the profile.
+func loadConfig() error {
+	cfg = &config{}
+	b, err := os.ReadFile(configfile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return usageError("unable to read config file: %v", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, cfg); err != nil {
+			return usageError("unable to parse config file %s: %v", configfile, err)
+		}
+		log.Debugf("Loaded configuration from %s", configfile)
+	}
+
+	prof = cfg.Profiles[profilename]
+	if prof == nil {
+		if profilename != "default" {
+			return usageError("no profile %q in %s", profilename, configfile)
+		}
+		prof = &profile{}
+	}
+	if providerarg != "" {
+		prof.Provider = providerarg
+	}
+	if prof.Provider == "" {
+		prof.Provider = "google"
+	}
+	if _, ok := providers[prof.Provider]; !ok {
+		return usageError("unsupported provider: %s", prof.Provider)
+	}
+	if prof.Credentials == "" {
+		prof.Credentials = "credentials.json"
+	}
+	if primaryOnly && calnames != "" {
+		return usageError("-primary and -calendar can't be used together")
+	}
+	for key, settings := range prof.Calendars {
+		if settings == nil {
+			prof.Calendars[key] = &calendarConfig{}
+			continue
+		}
+		if err := settings.check(); err != nil {
+			return usageError("calendar %q: %v", key, err)
+		}
+	}
+	for i, rule := range prof.Tags {
+		if rule == nil {
+			return usageError("tags[%d] is empty", i)
+		}
+		if err := rule.compile(); err != nil {
+			return usageError("tags[%d]: %v", i, err)
+		}
+	}
+	if prof.Token == "" {
+		// Keep the historical name for the default profile.
+		prof.Token = "token.json"
+		if profilename != "default" {
+			prof.Token = "token-" + profilename + ".json"
+		}
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+)
+
+var configPing bool
+
+func init() {
+	register(&command{
+		name:      "config",
+		args:      "check",
+		summary:   "Check the configuration file for mistakes",
+		complete:  []string{"check"},
+		anyConfig: true,
+		flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&configPing, "ping", false, "Also list the calendars of the selected profile, to check the authorization")
+		},
+		run: runConfig,
+	})
+}
+
+// unknownKeys walks the JSON against the type it is decoded into and
+// returns the paths of the keys the type has no field for, which
+// json.Unmarshal silently ignores.
+func unknownKeys(raw json.RawMessage, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	unknown := make([]string, 0)
+	switch t.Kind() {
+	case reflect.Struct:
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(raw, &obj) != nil {
+			return unknown
+		}
+		fields := map[string]reflect.Type{}
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			fields[name] = t.Field(i).Type
+		}
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			ft, ok := fields[key]
+			if !ok {
+				// json matches keys regardless of case.
+				for name, ftype := range fields {
+					if strings.EqualFold(name, key) {
+						ft, ok = ftype, true
+					}
+				}
+			}
+			if !ok {
+				unknown = append(unknown, path+"."+key)
+				continue
+			}
+			unknown = append(unknown, unknownKeys(obj[key], ft, path+"."+key)...)
+		}
+	case reflect.Map:
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(raw, &obj) != nil {
+			return unknown
+		}
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			unknown = append(unknown, unknownKeys(obj[key], t.Elem(), fmt.Sprintf("%s[%q]", path, key))...)
+		}
+	case reflect.Slice:
+		var list []json.RawMessage
+		if json.Unmarshal(raw, &list) != nil {
+			return unknown
+		}
+		for i, elem := range list {
+			unknown = append(unknown, unknownKeys(elem, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return unknown
+}
+
+// checkProfile returns the problems with a profile, other than unknown
+// keys.
+func checkProfile(p *profile) []string {
+	problems := make([]string, 0)
+	provider := p.Provider
+	if provider == "" {
+		provider = "google"
+	}
+	if _, ok := providers[provider]; !ok {
+		problems = append(problems, fmt.Sprintf("unsupported provider %q", provider))
+	}
+	switch provider {
+	case "google":
+		credentials := p.Credentials
+		if credentials == "" {
+			credentials = "credentials.json"
+		}
+		if b, err := os.ReadFile(credentials); err != nil {
+			problems = append(problems, fmt.Sprintf("unable to read the client secret file: %v", err))
+		} else if _, err := google.ConfigFromJSON(b); err != nil {
+			problems = append(problems, fmt.Sprintf("bad client secret file %s: %v", credentials, err))
+		}
+	case "msgraph":
+		if p.MSGraph == nil || p.MSGraph.ClientID == "" {
+			problems = append(problems, "msgraph.client_id is missing")
+		}
+	case "caldav":
+		if p.CalDAV == nil || p.CalDAV.URL == "" {
+			problems = append(problems, "caldav.url is missing")
+			break
+		}
+		if u, err := url.Parse(p.CalDAV.URL); err != nil || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("bad caldav.url %q", p.CalDAV.URL))
+		}
+		if auth := p.CalDAV.Auth; auth != "" && auth != "basic" && auth != "digest" {
+			problems = append(problems, fmt.Sprintf("caldav.auth must be basic or digest, not %q", auth))
+		}
+	}
+	for i, src := range p.ICS {
+		switch {
+		case src.URL == "":
+			problems = append(problems, fmt.Sprintf("ics[%d] has no url", i))
+		case !strings.Contains(src.URL, "://"):
+			if _, err := os.Stat(src.URL); err != nil {
+				problems = append(problems, fmt.Sprintf("ics[%d]: %v", i, err))
+			}
+		}
+	}
+	if p.QPS < 0 {
+		problems = append(problems, "qps can't be negative")
+	}
+	for i, rule := range p.Tags {
+		if rule == nil {
+			problems = append(problems, fmt.Sprintf("tags[%d] is empty", i))
+		} else if err := rule.compile(); err != nil {
+			problems = append(problems, fmt.Sprintf("tags[%d]: %v", i, err))
+		}
+	}
+	keys := make([]string, 0, len(p.Calendars))
+	for key := range p.Calendars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if settings := p.Calendars[key]; settings != nil {
+			if err := settings.check(); err != nil {
+				problems = append(problems, fmt.Sprintf("calendar %q: %v", key, err))
+			}
+		}
+	}
+	return problems
+}
+
+// ping lists the selected profile's calendars, without ever starting an
+// authorization, to check that the token still works.
+func ping(ctx context.Context) error {
+	if prof.Provider == "google" || prof.Provider == "msgraph" {
+		if _, err := os.Stat(prof.Token); err != nil {
+			return authError("%s: not authorized yet; run gcal auth", prof.Token)
+		}
+	}
+	p, err := newProvider(ctx)
+	if err != nil {
+		return err
+	}
+	list, err := p.Calendars(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("profile %s: %s answered with %d calendars\n", profilename, prof.Provider, len(list))
+	return nil
+}
+
+func runConfig(args []string) error {
+	if len(args) != 1 || args[0] != "check" {
+		return usageError("usage: gcal config check")
+	}
+	b, err := os.ReadFile(configfile)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("%s: no configuration file; gcal uses its defaults\n", configfile)
+		b = []byte("{}")
+	} else if err != nil {
+		return usageError("unable to read config file: %v", err)
+	}
+	var c config
+	if err := json.Unmarshal(b, &c); err != nil {
+		return usageError("%s: %v", configfile, err)
+	}
+	problems := 0
+	report := func(format string, args ...interface{}) {
+		fmt.Printf("%s: "+format+"\n", append([]interface{}{configfile}, args...)...)
+		problems++
+	}
+	for _, key := range unknownKeys(b, reflect.TypeOf(c), "") {
+		report("unknown key %s", strings.TrimPrefix(key, "."))
+	}
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		// Without profiles, the defaults make up the default profile.
+		c.Profiles = map[string]*profile{"default": {}}
+		names = append(names, "default")
+	}
+	for _, name := range names {
+		p := c.Profiles[name]
+		if p == nil {
+			p = &profile{}
+		}
+		for _, problem := range checkProfile(p) {
+			report("profile %s: %s", name, problem)
+		}
+	}
+	if configPing {
+		if prof == nil {
+			report("profile %s: not checking the authorization of a profile that doesn't load", profilename)
+		} else if err := ping(context.Background()); err != nil {
+			report("profile %s: %v", profilename, err)
+		}
+	}
+	if problems == 1 {
+		return usageError("1 problem found")
+	}
+	if problems > 0 {
+		return usageError("%d problems found", problems)
+	}
+	fmt.Printf("%s: ok\n", configfile)
+	return nil
+}
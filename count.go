@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+var (
+	countOnly   bool
+	showSummary bool
+)
+
+func init() {
+	flag.BoolVar(&countOnly, "count", false, "Only print the number of events; with -format json, also the number per calendar")
+	flag.BoolVar(&showSummary, "summary", false, "Sum the run up on stderr: how many events, from how many calendars, over which days")
+}
+
+// eventCount is what -count -format json prints.
+type eventCount struct {
+	Total     int            `json:"total"`
+	Calendars map[string]int `json:"calendars"`
+}
+
+// printCount writes the number of events for -count, and returns
+// errNoEvents if there are none, like printing them would.
+func printCount(w io.Writer, events []*agendaEvent, calendars []*calendar.CalendarListEntry) error {
+	if format == "json" {
+		count := &eventCount{Total: len(events), Calendars: map[string]int{}}
+		// The calendars without events count too, as zero, under the
+		// name their events have.
+		for _, item := range calendars {
+			name := calendarName(item)
+			if anonymize {
+				name = anonymousName("calendar", name)
+			}
+			count.Calendars[countName(name, item.Id)] += 0
+		}
+		for _, ev := range events {
+			count.Calendars[countName(ev.Calendar, ev.CalendarID)]++
+		}
+		b, err := json.MarshalIndent(count, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\n", b)
+	} else {
+		fmt.Fprintln(w, len(events))
+	}
+	if len(events) == 0 {
+		return errNoEvents
+	}
+	return nil
+}
+
+// countName is what a calendar is counted under: its name, or its id if
+// it has none, which -anonymize hides too.
+func countName(name, id string) string {
+	if name != "" {
+		return name
+	}
+	if anonymize {
+		return anonymousName("calendar", id)
+	}
+	return id
+}
+
+// plural is "1 event" or "2 events".
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// runSummary is the line -summary prints after the events, as in
+// "12 events from 3 calendars, 2025-03-01→2025-03-07".
+func runSummary(events []*agendaEvent, calendars []*calendar.CalendarListEntry) (string, error) {
+	start, end, err := agendaWindow(time.Now().Local(), duration)
+	if err != nil {
+		return "", err
+	}
+	// The window ends at midnight, after its last day.
+	last := end.Add(-time.Nanosecond)
+	return fmt.Sprintf("%s from %s, %s→%s", plural(len(events), "event"), plural(len(calendars), "calendar"),
+		start.Format("2006-01-02"), last.Format("2006-01-02")), nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	fromDate string
+	toDate   string
+)
+
+func init() {
+	flag.StringVar(&fromDate, "from", "", "Start of the window, e.g. \"next monday\" or 2025-03-01 (default today)")
+	flag.StringVar(&toDate, "to", "", "End of the window, e.g. \"end of month\" or friday (default -from plus -duration)")
+}
+
+// weekday understands the names of the days of the week and their
+// abbreviations, such as thu or thurs.
+func weekday(name string) (time.Weekday, bool) {
+	if len(name) < 3 {
+		return 0, false
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.HasPrefix(strings.ToLower(d.String()), name) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// period is a stretch of calendar such as a day or a week, which an
+// expression can take the start or the end of.
+type period struct {
+	start, end time.Time
+}
+
+// periodOf is the day, week (starting on Monday), month or year around
+// t.
+func periodOf(t time.Time, unit string) (period, bool) {
+	day := midnight(t)
+	switch unit {
+	case "day":
+		return period{day, day.AddDate(0, 0, 1)}, true
+	case "week":
+		monday := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		return period{monday, monday.AddDate(0, 0, 7)}, true
+	case "month":
+		first := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+		return period{first, first.AddDate(0, 1, 0)}, true
+	case "year":
+		first := time.Date(t.Year(), 1, 1, 0, 0, 0, 0, t.Location())
+		return period{first, first.AddDate(1, 0, 0)}, true
+	}
+	return period{}, false
+}
+
+// shift moves t by n days, weeks, months or years.
+func shift(t time.Time, n int, unit string) (time.Time, bool) {
+	switch strings.TrimSuffix(unit, "s") {
+	case "day":
+		return t.AddDate(0, 0, n), true
+	case "week":
+		return t.AddDate(0, 0, 7*n), true
+	case "month":
+		return t.AddDate(0, n, 0), true
+	case "year":
+		return t.AddDate(n, 0, 0), true
+	}
+	return t, false
+}
+
+// parsePeriod understands the expressions for a stretch of calendar:
+// today, tomorrow, yesterday, weekdays (on or after today, or with
+// next, last or this), this, next or last week, month or year, in N
+// units, N units ago, and dates.
+func parsePeriod(now time.Time, words []string) (period, error) {
+	expr := strings.Join(words, " ")
+	day, _ := periodOf(now, "day")
+	switch expr {
+	case "today":
+		return day, nil
+	case "tomorrow":
+		return period{day.end, day.end.AddDate(0, 0, 1)}, nil
+	case "yesterday":
+		return period{day.start.AddDate(0, 0, -1), day.start}, nil
+	case "week", "month", "year":
+		p, _ := periodOf(now, expr)
+		return p, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", expr, now.Location()); err == nil {
+		p, _ := periodOf(t, "day")
+		return p, nil
+	}
+	if len(words) == 1 {
+		if d, ok := weekday(words[0]); ok {
+			ahead := (int(d) - int(now.Weekday()) + 7) % 7
+			p, _ := periodOf(now.AddDate(0, 0, ahead), "day")
+			return p, nil
+		}
+	}
+	if len(words) == 2 {
+		if p, ok := periodOf(now, words[1]); ok {
+			switch words[0] {
+			case "this":
+				return p, nil
+			case "next":
+				t, _ := shift(now, 1, words[1])
+				p, _ = periodOf(t, words[1])
+				return p, nil
+			case "last":
+				t, _ := shift(now, -1, words[1])
+				p, _ = periodOf(t, words[1])
+				return p, nil
+			}
+		}
+		if d, ok := weekday(words[1]); ok {
+			var offset int
+			switch words[0] {
+			case "next":
+				offset = (int(d)-int(now.Weekday())+6)%7 + 1
+			case "last":
+				offset = -((int(now.Weekday())-int(d)+6)%7 + 1)
+			case "this":
+				offset = (int(d)+6)%7 - (int(now.Weekday())+6)%7
+			default:
+				return period{}, fmt.Errorf("don't know %q", expr)
+			}
+			p, _ := periodOf(now.AddDate(0, 0, offset), "day")
+			return p, nil
+		}
+	}
+	if len(words) == 3 && words[0] == "in" || len(words) == 3 && words[2] == "ago" {
+		count, unit := words[1], words[2]
+		sign := 1
+		if words[2] == "ago" {
+			count, unit, sign = words[0], words[1], -1
+		}
+		n, err := strconv.Atoi(count)
+		if err == nil {
+			if t, ok := shift(now, sign*n, unit); ok {
+				p, _ := periodOf(t, "day")
+				return p, nil
+			}
+		}
+	}
+	return period{}, fmt.Errorf("don't know %q", expr)
+}
+
+// parseDate turns a date expression into a time. Expressions naming a
+// stretch of calendar give its start, or with end set, the end of it, so
+// that -to friday includes Friday. "start of" and "end of" pick one of
+// them whatever end is, and "now" is now.
+func parseDate(now time.Time, expr string, end bool) (time.Time, error) {
+	expr = strings.TrimSpace(expr)
+	if t, err := time.Parse(time.RFC3339, expr); err == nil {
+		return t, nil
+	}
+	expr = strings.ToLower(expr)
+	if expr == "now" {
+		return now, nil
+	}
+	words := strings.Fields(expr)
+	if len(words) > 2 && words[1] == "of" {
+		switch words[0] {
+		case "start", "beginning":
+			end = false
+		case "end":
+			end = true
+		default:
+			return time.Time{}, fmt.Errorf("don't know %q", expr)
+		}
+		words = words[2:]
+	}
+	p, err := parsePeriod(now, words)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		return p.end, nil
+	}
+	return p.start, nil
+}
+
+// parseRange turns a duration expression such as "rest of week" or "next
+// month" into a window.
+func parseRange(now time.Time, expr string) (time.Time, time.Time, error) {
+	words := strings.Fields(strings.ToLower(expr))
+	start := midnight(now)
+	if len(words) > 2 && words[0] == "rest" && words[1] == "of" {
+		p, err := parsePeriod(now, words[2:])
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		if p.start.After(start) {
+			start = p.start
+		}
+		return start, p.end, nil
+	}
+	p, err := parsePeriod(now, words)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return p.start, p.end, nil
+}
+
+// agendaWindow is the window to read events in for a duration, moved to
+// start at -from and to end at -to when they are given.
+func agendaWindow(now time.Time, duration string) (time.Time, time.Time, error) {
+	origin := now
+	if fromDate != "" {
+		from, err := parseDate(now, fromDate, false)
+		if err != nil {
+			return time.Time{}, time.Time{}, usageError("bad -from: %v", err)
+		}
+		origin = from
+	}
+	start, end, err := window(origin, duration)
+	if err != nil {
+		return start, end, err
+	}
+	if fromDate != "" {
+		start = origin
+	}
+	if toDate != "" {
+		if end, err = parseDate(now, toDate, true); err != nil {
+			return time.Time{}, time.Time{}, usageError("bad -to: %v", err)
+		}
+	}
+	if !end.After(start) {
+		return start, end, usageError("the window ends at %s, before it starts at %s",
+			end.Format(time.RFC3339), start.Format(time.RFC3339))
+	}
+	return start, end, nil
+}
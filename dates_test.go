@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func day(now time.Time, year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, now.Location())
+}
+
+func TestParseRange(t *testing.T) {
+	now := testNow(t)
+	tests := []struct {
+		expr       string
+		start, end time.Time
+	}{
+		{"today", day(now, 2025, 3, 5), day(now, 2025, 3, 6)},
+		{"tomorrow", day(now, 2025, 3, 6), day(now, 2025, 3, 7)},
+		{"yesterday", day(now, 2025, 3, 4), day(now, 2025, 3, 5)},
+		{"week", day(now, 2025, 3, 3), day(now, 2025, 3, 10)},
+		{"this week", day(now, 2025, 3, 3), day(now, 2025, 3, 10)},
+		{"next week", day(now, 2025, 3, 10), day(now, 2025, 3, 17)},
+		{"Next Month", day(now, 2025, 4, 1), day(now, 2025, 5, 1)},
+		{"last month", day(now, 2025, 2, 1), day(now, 2025, 3, 1)},
+		{"this year", day(now, 2025, 1, 1), day(now, 2026, 1, 1)},
+		{"friday", day(now, 2025, 3, 7), day(now, 2025, 3, 8)},
+		{"wed", day(now, 2025, 3, 5), day(now, 2025, 3, 6)},
+		{"next wednesday", day(now, 2025, 3, 12), day(now, 2025, 3, 13)},
+		{"last wednesday", day(now, 2025, 2, 26), day(now, 2025, 2, 27)},
+		{"this monday", day(now, 2025, 3, 3), day(now, 2025, 3, 4)},
+		{"next thurs", day(now, 2025, 3, 6), day(now, 2025, 3, 7)},
+		{"in 3 days", day(now, 2025, 3, 8), day(now, 2025, 3, 9)},
+		{"2 weeks ago", day(now, 2025, 2, 19), day(now, 2025, 2, 20)},
+		{"2025-04-01", day(now, 2025, 4, 1), day(now, 2025, 4, 2)},
+		{"rest of week", day(now, 2025, 3, 5), day(now, 2025, 3, 10)},
+		{"rest of next week", day(now, 2025, 3, 10), day(now, 2025, 3, 17)},
+	}
+	for _, tt := range tests {
+		start, end, err := parseRange(now, tt.expr)
+		if err != nil {
+			t.Errorf("parseRange(%q): %v", tt.expr, err)
+			continue
+		}
+		if !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("parseRange(%q) = %v, %v; want %v, %v", tt.expr, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func TestParsePeriodErrors(t *testing.T) {
+	now := testNow(t)
+	for _, expr := range []string{"someday", "next fortnight", "in x days", "tu", "after friday", "rest of", "2025-02-30"} {
+		if p, err := parsePeriod(now, strings.Fields(expr)); err == nil {
+			t.Errorf("parsePeriod(%q) = %v, want an error", expr, p)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	now := testNow(t)
+	tests := []struct {
+		expr string
+		end  bool
+		want time.Time
+	}{
+		{"now", false, now},
+		{"2025-03-20T09:00:00-04:00", false, time.Date(2025, 3, 20, 13, 0, 0, 0, time.UTC)},
+		{"friday", false, day(now, 2025, 3, 7)},
+		// The end of a day is the midnight after it, so -to friday
+		// includes Friday.
+		{"friday", true, day(now, 2025, 3, 8)},
+		{"end of month", false, day(now, 2025, 4, 1)},
+		{"start of next week", true, day(now, 2025, 3, 10)},
+		{"beginning of year", true, day(now, 2025, 1, 1)},
+		{" End of Week ", false, day(now, 2025, 3, 10)},
+	}
+	for _, tt := range tests {
+		got, err := parseDate(now, tt.expr, tt.end)
+		if err != nil {
+			t.Errorf("parseDate(%q, %v): %v", tt.expr, tt.end, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseDate(%q, %v) = %v, want %v", tt.expr, tt.end, got, tt.want)
+		}
+	}
+	for _, expr := range []string{"middle of week", "end of", "soon"} {
+		if got, err := parseDate(now, expr, false); err == nil {
+			t.Errorf("parseDate(%q) = %v, want an error", expr, got)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+var dedupeApply bool
+
+func init() {
+	register(&command{
+		name:    "dedupe",
+		args:    "calendar",
+		summary: "List the duplicate events in a calendar, and delete them with -apply",
+		flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&dedupeApply, "apply", false, "Delete the duplicates instead of listing them")
+		},
+		run: runDedupe,
+	})
+}
+
+// A duplicate is an event that is already in the calendar as original.
+type duplicate struct {
+	ev, original *agendaEvent
+	reason       string
+}
+
+// findDuplicates pairs each event that is the same as an earlier one
+// with it: same iCalUID and start, or same summary, start and end. Of
+// the copies, the one created first is kept.
+func findDuplicates(events []*agendaEvent) []*duplicate {
+	sorted := append([]*agendaEvent{}, events...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Created != sorted[j].Created {
+			return sorted[i].Created < sorted[j].Created
+		}
+		return sorted[i].Id < sorted[j].Id
+	})
+	byUID := map[string]*agendaEvent{}
+	byTime := map[string]*agendaEvent{}
+	dups := make([]*duplicate, 0)
+	for _, ev := range sorted {
+		if ev.Task || ev.Buffer {
+			continue
+		}
+		uidKey := ev.ICalUID + "\x00" + ev.Start.String()
+		timeKey := summary(ev) + "\x00" + ev.Start.String() + "\x00" + ev.End.String()
+		if original, ok := byUID[uidKey]; ok && ev.ICalUID != "" {
+			dups = append(dups, &duplicate{ev, original, "same iCalUID"})
+			continue
+		}
+		if original, ok := byTime[timeKey]; ok {
+			dups = append(dups, &duplicate{ev, original, "same summary and time"})
+			continue
+		}
+		byUID[uidKey] = ev
+		byTime[timeKey] = ev
+	}
+	return dups
+}
+
+// duplicateSeries are the recurring events that are copies of another:
+// every one of their instances in the window duplicates an instance of
+// the same other series. Those are deleted whole rather than instance
+// by instance.
+func duplicateSeries(events []*agendaEvent, dups []*duplicate) map[string]bool {
+	instances := map[string]int{}
+	for _, ev := range events {
+		if ev.RecurringEventId != "" {
+			instances[ev.RecurringEventId]++
+		}
+	}
+	of := map[string]string{}
+	duplicated := map[string]int{}
+	for _, d := range dups {
+		series, other := d.ev.RecurringEventId, d.original.RecurringEventId
+		if series == "" || other == "" || series == other {
+			continue
+		}
+		if prev, ok := of[series]; ok && prev != other {
+			// It copies more than one series; leave it be.
+			duplicated[series] = -len(events)
+			continue
+		}
+		of[series] = other
+		duplicated[series]++
+	}
+	whole := map[string]bool{}
+	for series, n := range duplicated {
+		if n == instances[series] {
+			whole[series] = true
+		}
+	}
+	return whole
+}
+
+func runDedupe(args []string) error {
+	if len(args) != 1 {
+		return usageError("usage: gcal dedupe [-apply] calendar")
+	}
+	if dedupeApply {
+		scopes = append(scopes, calendar.CalendarEventsScope)
+	}
+	localzone, err := localZone()
+	if err != nil {
+		return err
+	}
+	// Read the one calendar, whatever the profile usually reads.
+	calnames, primaryOnly = args[0], false
+	ctx := context.Background()
+	events, read, err := fetchEvents(ctx, duration, localzone)
+	if err != nil {
+		return err
+	}
+	if len(read) != 1 {
+		return usageError("%q matches %d calendars; give one calendar's id or name", args[0], len(read))
+	}
+	dups := findDuplicates(events)
+	if len(dups) == 0 {
+		log.Infof("No duplicates among the %d events of %s", len(events), args[0])
+		return nil
+	}
+	w, ok := dups[0].ev.Provider.(writer)
+	if dedupeApply && !ok {
+		return usageError("%s can't be changed from gcal", args[0])
+	}
+	whole := duplicateSeries(events, dups)
+	deleted := map[string]bool{}
+	for _, d := range dups {
+		ev := d.ev
+		if series := ev.RecurringEventId; whole[series] {
+			if deleted[series] {
+				continue
+			}
+			deleted[series] = true
+			copied := *ev
+			copied.Event = &calendar.Event{Id: series, Summary: ev.Summary}
+			fmt.Printf("%s  %s  (recurring; copy of series %s)\n", eventWhen(ev), summary(ev), d.original.RecurringEventId)
+			ev = &copied
+		} else {
+			fmt.Printf("%s  %s  (%s as %s)\n", eventWhen(ev), summary(ev), d.reason, d.original.Id)
+		}
+		if !dedupeApply {
+			continue
+		}
+		if err := w.Delete(ctx, ev); err != nil {
+			return err
+		}
+	}
+	if !dedupeApply {
+		log.Infof("Run gcal dedupe -apply %s to delete them", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffOp is one line of an edit script: ' ' to keep, '-' to delete, '+'
+// to insert.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines computes a minimal edit script from a to b, via the longest
+// common subsequence. That is quadratic, which is fine for the size of
+// the files we write.
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	ops := make([]diffOp, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// unifiedDiff renders the change from old to new as a unified diff with
+// three lines of context, or "" if there is no change.
+func unifiedDiff(name, old, new string) string {
+	const context = 3
+	ops := diffLines(splitLines(old), splitLines(new))
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", name, name)
+	changed := false
+	// line numbers in old and new at the start of each op
+	aline := make([]int, len(ops)+1)
+	bline := make([]int, len(ops)+1)
+	for k, op := range ops {
+		aline[k+1], bline[k+1] = aline[k], bline[k]
+		if op.kind != '+' {
+			aline[k+1]++
+		}
+		if op.kind != '-' {
+			bline[k+1]++
+		}
+	}
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+		changed = true
+		start := max(k-context, 0)
+		// Extend the hunk until we see more than 2*context unchanged
+		// lines in a row, or run out of lines.
+		end, same := k, 0
+		for end < len(ops) && same <= 2*context {
+			if ops[end].kind == ' ' {
+				same++
+			} else {
+				same = 0
+			}
+			end++
+		}
+		end -= max(same-context, 0)
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aline[start], aline[end]),
+			hunkRange(bline[start], bline[end]))
+		for _, op := range ops[start:end] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		k = end
+	}
+	if !changed {
+		return ""
+	}
+	return sb.String()
+}
+
+// hunkRange formats the lines [from, to) the way diff -u does.
+func hunkRange(from, to int) string {
+	if from == to {
+		return fmt.Sprintf("%d,0", from)
+	}
+	return fmt.Sprintf("%d,%d", from+1, to-from)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var (
+	digestSMTP     string
+	digestUser     string
+	digestFrom     string
+	digestTo       string
+	digestSubject  string
+	digestTemplate string
+	digestBody     string
+)
+
+func init() {
+	register(&command{
+		name:    "digest",
+		summary: "Email the agenda, e.g. from a morning cron job",
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&digestSMTP, "smtp", "localhost:25", "SMTP server host:port; port 465 means TLS")
+			fs.StringVar(&digestUser, "smtp-user", "", "SMTP user name, with the password in GCAL_SMTP_PASSWORD")
+			fs.StringVar(&digestFrom, "from", "", "Sender address (default the first -to address)")
+			fs.StringVar(&digestTo, "to", "", "Recipient addresses, comma separated")
+			fs.StringVar(&digestSubject, "subject", `Agenda for {{.Date.Format "Mon Jan 02"}}: {{.Count}} events`, "Subject template")
+			fs.StringVar(&digestTemplate, "template", "", "Template file for the body; {{.Agenda}} is the rendered agenda")
+			fs.StringVar(&digestBody, "body", "html", "Body format (html|markdown)")
+		},
+		run: runDigest,
+	})
+}
+
+// digestData is what the subject and body templates see.
+type digestData struct {
+	Date     time.Time
+	Count    int
+	Duration string
+	Events   []*jsonEvent
+	// Agenda is the agenda rendered in the body format.
+	Agenda string
+}
+
+func runDigest(args []string) error {
+	if digestTo == "" {
+		return usageError("no -to address given")
+	}
+	to := strings.Split(digestTo, ",")
+	for i := range to {
+		to[i] = strings.TrimSpace(to[i])
+	}
+	from := digestFrom
+	if from == "" {
+		from = to[0]
+	}
+	var ctype string
+	switch digestBody {
+	case "html":
+		ctype = "text/html; charset=utf-8"
+	case "markdown":
+		ctype = "text/plain; charset=utf-8"
+	default:
+		return usageError("-body must be html or markdown, not %s", digestBody)
+	}
+	subject, err := template.New("subject").Parse(digestSubject)
+	if err != nil {
+		return usageError("bad -subject template: %v", err)
+	}
+	body := template.Must(template.New("body").Parse("{{.Agenda}}"))
+	if digestTemplate != "" {
+		if body, err = template.ParseFiles(digestTemplate); err != nil {
+			return usageError("bad -template: %v", err)
+		}
+	}
+	if _, err := parseFilters(); err != nil {
+		return err
+	}
+	if err := loadAlsoZones(); err != nil {
+		return err
+	}
+
+	localzone, err := localZone()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	events, _, err := agendaEvents(ctx, duration, localzone)
+	if err != nil {
+		return err
+	}
+
+	data := &digestData{
+		Date:     time.Now().In(localzone),
+		Count:    len(events),
+		Duration: duration,
+		Events:   make([]*jsonEvent, 0, len(events)),
+	}
+	for _, ev := range sortedByStart(events) {
+		data.Events = append(data.Events, newJSONEvent(ev))
+	}
+	var agenda bytes.Buffer
+	if err := formatters[digestBody](&agenda, events); err != nil {
+		return err
+	}
+	data.Agenda = agenda.String()
+	var subj, text bytes.Buffer
+	if err := subject.Execute(&subj, data); err != nil {
+		return usageError("bad -subject template: %v", err)
+	}
+	if err := body.Execute(&text, data); err != nil {
+		return usageError("bad -template: %v", err)
+	}
+
+	msg, err := digestMessage(from, to, subj.String(), ctype, text.Bytes())
+	if err != nil {
+		return err
+	}
+	return mutate(fmt.Sprintf("email the agenda to %s", strings.Join(to, ", ")), func() error {
+		return sendMail(digestSMTP, from, to, msg)
+	})
+}
+
+// digestMessage puts together the mail headers and body.
+func digestMessage(from string, to []string, subject, ctype string, body []byte) ([]byte, error) {
+	var id [12]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, fmt.Errorf("unable to make a Message-ID: %w", err)
+	}
+	host, _ := os.Hostname()
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id[:]), host)
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: %s\r\n", ctype)
+	fmt.Fprintf(&msg, "Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.Write(bytes.ReplaceAll(bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n")))
+	return msg.Bytes(), nil
+}
+
+// sendMail sends the message, with TLS from the start on port 465 and
+// with STARTTLS elsewhere when the server offers it.
+func sendMail(addr, from string, to []string, msg []byte) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return usageError("bad -smtp address %q: %v", addr, err)
+	}
+	var auth smtp.Auth
+	if digestUser != "" {
+		auth = smtp.PlainAuth("", digestUser, os.Getenv("GCAL_SMTP_PASSWORD"), host)
+	}
+	if port != "465" {
+		if err := smtp.SendMail(addr, auth, from, to, msg); err != nil {
+			return apiError("unable to send mail: %v", err)
+		}
+		return nil
+	}
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: host})
+	if err != nil {
+		return apiError("unable to send mail: %v", err)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return apiError("unable to send mail: %v", err)
+	}
+	defer c.Close()
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return authError("unable to log in to %s: %v", addr, err)
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return apiError("unable to send mail: %v", err)
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return apiError("unable to send mail to %s: %v", rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return apiError("unable to send mail: %v", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return apiError("unable to send mail: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return apiError("unable to send mail: %v", err)
+	}
+	return c.Quit()
+}
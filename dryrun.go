@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	dryRun bool
+	// dryRunOut receives the description of what a dry run would have
+	// done. It is stderr so that it never mixes with the calendar output.
+	dryRunOut io.Writer = os.Stderr
+)
+
+func init() {
+	flag.BoolVar(&dryRun, "dry-run", false, "Print the changes that would be made to files and calendars without making them")
+}
+
+// mutate performs a change to local files or to a calendar, or with
+// -dry-run just reports what it would have been. Every write should go
+// through here or through writeFile.
+func mutate(desc string, apply func() error) error {
+	if dryRun {
+		fmt.Fprintf(dryRunOut, "dry-run: would %s\n", desc)
+		return nil
+	}
+	log.Debugf("%s", desc)
+	return apply()
+}
+
+// writeFile is os.WriteFile, except that with -dry-run it prints a diff
+// against the current contents of the file instead.
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	if !dryRun {
+		return os.WriteFile(path, data, perm)
+	}
+	old, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err != nil {
+		fmt.Fprintf(dryRunOut, "dry-run: would create %s\n", path)
+	} else if bytes.Equal(old, data) {
+		return nil
+	} else {
+		fmt.Fprintf(dryRunOut, "dry-run: would update %s\n", path)
+	}
+	fmt.Fprint(dryRunOut, unifiedDiff(path, string(old), string(data)))
+	return nil
+}
+
+// removeFile is os.Remove, honouring -dry-run.
+func removeFile(path string) error {
+	return mutate("remove "+path, func() error {
+		return os.Remove(path)
+	})
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// agendaEvent is a calendar event along with what we know about where it
+// came from and when it starts in local time.
+type agendaEvent struct {
+	*calendar.Event
+	Calendar   string
+	CalendarID string
+	// Provider is where the event came from.
+	Provider provider
+	// Settings are the configuration overrides for the calendar.
+	Settings *calendarConfig
+	// Start and End are in local time. All-day events start and end
+	// at local midnight.
+	Start  time.Time
+	End    time.Time
+	AllDay bool
+	// Demoted events are outside the hours asked for with
+	// -business-hours or -weekdays, but kept with -outside-hours demote.
+	Demoted bool
+	// Task is set for Google Tasks, which we carry around as events.
+	Task bool
+	// Buffer is set for the travel/prep blocks -buffer adds before
+	// events.
+	Buffer bool
+	// DefaultReminders are the reminders of the calendar, for events
+	// that use them.
+	DefaultReminders []*calendar.EventReminder
+	// Kind is kindBirthday or kindHoliday for events from those special
+	// calendars, and empty for everything else.
+	Kind string
+	// Exceptions are the days, in local time, on which a recurring event
+	// read whole with -no-expand no longer has an instance, because it
+	// was cancelled or moved.
+	Exceptions []time.Time
+	// Tags are those of the tag rules the event matches.
+	Tags []string
+	// WindowStart and WindowEnd are the window the event was read in,
+	// which recurring events are expanded over.
+	WindowStart time.Time
+	WindowEnd   time.Time
+}
+
+// StableID is an identifier for the event that stays the same from run
+// to run, whatever happens to its summary or time, so that tools reading
+// our output can tell which lines are about the same event.
+func (ev *agendaEvent) StableID() string {
+	sum := sha1.Sum([]byte(ev.CalendarID + "\x00" + ev.Id))
+	return hex.EncodeToString(sum[:8])
+}
+
+// window returns the start and end of the time range selected by a
+// duration such as the -duration flag: a number of days, weeks, months
+// or years from midnight today, as in 1d, 2w, 1m or 1y, or an expression
+// such as "rest of week" or "next month".
+func window(now time.Time, duration string) (time.Time, time.Time, error) {
+	midnight_today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	n, err := strconv.Atoi(duration[:max(len(duration)-1, 0)])
+	if err != nil || n < 1 {
+		if start, end, err := parseRange(now.In(time.Local), duration); err == nil {
+			return start, end, nil
+		}
+		return time.Time{}, time.Time{}, usageError("invalid duration: %s", duration)
+	}
+	switch duration[len(duration)-1] {
+	case 'd':
+		return midnight_today, midnight_today.AddDate(0, 0, n), nil
+	case 'w':
+		return midnight_today, midnight_today.AddDate(0, 0, 7*n), nil
+	case 'm':
+		return midnight_today, midnight_today.AddDate(0, n, 0), nil
+	case 'y':
+		return midnight_today, midnight_today.AddDate(n, 0, 0), nil
+	}
+	return time.Time{}, time.Time{}, usageError("invalid duration: %s", duration)
+}
+
+// selected reports whether the calendar was picked with -calendar, by id,
+// name or description.
+func selected(item *calendar.CalendarListEntry) bool {
+	for _, name := range strings.Split(calnames, ",") {
+		name = strings.TrimSpace(name)
+		if name == item.Id ||
+			strings.EqualFold(name, strings.TrimSpace(item.Summary)) ||
+			strings.EqualFold(name, strings.TrimSpace(item.Description)) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseEventTime parses the start or end of an event, which is either a
+// date for all-day events or a full timestamp.
+func parseEventTime(edt *calendar.EventDateTime) (time.Time, bool, error) {
+	if edt == nil {
+		return time.Time{}, false, fmt.Errorf("missing time")
+	}
+	if edt.DateTime == "" {
+		// 2025-01-05
+		t, err := time.Parse("2006-01-02", edt.Date)
+		if err != nil {
+			return t, true, fmt.Errorf("bad date %q: %w", edt.Date, err)
+		}
+		return t, true, nil
+	}
+	// 2025-01-05T10:00:00-05:00
+	t, err := time.Parse(time.RFC3339, edt.DateTime)
+	if err != nil {
+		return t, false, fmt.Errorf("bad time %q: %w", edt.DateTime, err)
+	}
+	return t, false, nil
+}
+
+// selectCalendars picks the calendars to read: the ones named with
+// -calendar if any, otherwise all but the excluded ones and, unless
+// -emptycal is given, the ones without a name.
+func selectCalendars(calendar_list []*calendar.CalendarListEntry) []*calendar.CalendarListEntry {
+	picked := make([]*calendar.CalendarListEntry, 0, len(calendar_list))
+	for _, item := range calendar_list {
+		settings := calendarSettings(item)
+		if calnames != "" {
+			if !selected(item) {
+				continue
+			}
+		} else if settings.Exclude {
+			continue
+		} else if skipKind(calendarKind(item)) {
+			continue
+		} else if calendarName(item) == "" && !emptycal && !settings.Include {
+			continue
+		}
+		picked = append(picked, item)
+	}
+	return picked
+}
+
+// calendarName is the name we show for a calendar: its description, as
+// gcal always did, unless the configuration renames it.
+func calendarName(item *calendar.CalendarListEntry) string {
+	if name := calendarSettings(item).Name; name != "" {
+		return name
+	}
+	return strings.TrimSpace(item.Description)
+}
+
+// collectEvents fetches the events of every calendar in the list, over
+// the window of dur unless the calendar has its own. An event we cannot
+// make sense of is skipped with a warning, unless strict is set, in which
+// case it aborts the run.
+func collectEvents(ctx context.Context, p provider, calendar_list []*calendar.CalendarListEntry, dur string, localzone *time.Location) ([]*agendaEvent, error) {
+	now := time.Now().Local()
+	fetched := make([][]*calendar.Event, len(calendar_list))
+	windows := make([][2]time.Time, len(calendar_list))
+	errs := forEachCalendar(len(calendar_list), func(i int) error {
+		item := calendar_list[i]
+		caldur := dur
+		if settings := calendarSettings(item); settings.Duration != "" {
+			caldur = settings.Duration
+		}
+		start, end, err := agendaWindow(now, caldur)
+		if err != nil {
+			return err
+		}
+		log.Debugf("Querying calendar %s for events from %s to %s", item.Id, start, end)
+		events, err := p.Events(ctx, item.Id, start, end)
+		if err != nil {
+			return err
+		}
+		log.Debugf("Found %d events in calendar %s", len(events), item.Id)
+		dumpEvents(item.Id, start, end, events)
+		fetched[i] = events
+		windows[i] = [2]time.Time{start, end}
+		return nil
+	})
+	failed := 0
+	for _, err := range errs {
+		if err != nil && (fatal(err) || failFast) {
+			return nil, err
+		}
+		// Calendars we can't read any more are only skipped, even if
+		// that leaves none.
+		if err != nil && !inaccessible(err) {
+			failed++
+		}
+	}
+	if failed > 0 && failed == len(errs) {
+		// Nothing to show for it: that's no partial failure.
+		return nil, errs[0]
+	}
+
+	collected := make([]*agendaEvent, 0)
+	for i, item := range calendar_list {
+		if errs[i] != nil {
+			name := calendarName(item)
+			if name == "" {
+				name = item.Id
+			}
+			calendarFailed(name, errs[i])
+			continue
+		}
+		settings := calendarSettings(item)
+		series := map[string]*agendaEvent{}
+		exceptions := map[string][]time.Time{}
+		for _, event := range fetched[i] {
+			// Without expanding, the instances of a series that were
+			// cancelled or moved come apart, and say what to skip.
+			if noExpand && event.RecurringEventId != "" {
+				if t, ok := exceptionDate(event, localzone); ok {
+					exceptions[event.RecurringEventId] = append(exceptions[event.RecurringEventId], t)
+				}
+				if event.Status == "cancelled" {
+					continue
+				}
+			}
+			evstart, evend, allday, err := eventSpan(event, localzone)
+			if err != nil {
+				err = fmt.Errorf("event %s in calendar %s: %w", event.Id, item.Id, err)
+				if strict {
+					return nil, apiError("%v", err)
+				}
+				log.Warningf("skipping %v", err)
+				continue
+			}
+			markSelf(event)
+			kind := eventKind(item, event)
+			if skipKind(kind) {
+				continue
+			}
+			ev := &agendaEvent{
+				Event:            event,
+				Calendar:         calendarName(item),
+				CalendarID:       item.Id,
+				Provider:         p,
+				Settings:         settings,
+				DefaultReminders: item.DefaultReminders,
+				// Convert to localtime.
+				Start:       evstart.In(localzone),
+				End:         evend.In(localzone),
+				AllDay:      allday,
+				Kind:        kind,
+				WindowStart: windows[i][0],
+				WindowEnd:   windows[i][1],
+			}
+			if len(event.Recurrence) > 0 {
+				series[event.Id] = ev
+			}
+			collected = append(collected, ev)
+		}
+		for id, days := range exceptions {
+			if ev, ok := series[id]; ok {
+				ev.Exceptions = days
+			}
+		}
+	}
+	return collected, nil
+}
+
+// markSelf marks the attendee with the profile's email as us, for the
+// providers that can't tell.
+func markSelf(ev *calendar.Event) {
+	if prof == nil || prof.Email == "" {
+		return
+	}
+	for _, att := range ev.Attendees {
+		if strings.EqualFold(att.Email, prof.Email) {
+			att.Self = true
+		}
+	}
+}
+
+// sortEvents orders events by start time, for providers whose servers
+// don't.
+func sortEvents(events []*calendar.Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventStartKey(events[i]) < eventStartKey(events[j])
+	})
+}
+
+// eventStartKey is a sort key for the start of an event. All-day events
+// sort before timed events on the same day.
+func eventStartKey(ev *calendar.Event) string {
+	t, allday, err := parseEventTime(ev.Start)
+	if err != nil {
+		return ""
+	}
+	if allday {
+		return t.Format("2006-01-02")
+	}
+	return t.UTC().Format("2006-01-02T15:04:05")
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	businessHours string
+	weekdays      string
+	outsideHours  string
+)
+
+func init() {
+	flag.StringVar(&businessHours, "business-hours", "", "Only keep events overlapping these hours, e.g. 09:00-18:00")
+	flag.StringVar(&weekdays, "weekdays", "", "Only keep events on these days, e.g. mon-fri or mon,wed,fri")
+	flag.StringVar(&outsideHours, "outside-hours", "drop", "What to do with events outside -business-hours and -weekdays (drop|demote)")
+}
+
+// filters holds the parsed filtering flags.
+type filters struct {
+	// from and to are minutes since midnight; to is 0 when there are no
+	// business hours.
+	from, to int
+	days     map[time.Weekday]bool
+}
+
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("bad time %q, want HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseWeekdays parses a list of days and ranges of days, which may wrap
+// around the end of the week, as in fri-mon.
+func parseWeekdays(s string) (map[time.Weekday]bool, error) {
+	days := map[time.Weekday]bool{}
+	for _, part := range strings.Split(strings.ToLower(s), ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		from, ok := dayNames[first[:min(len(first), 3)]]
+		if !ok {
+			return nil, fmt.Errorf("bad weekday %q", first)
+		}
+		to := from
+		if isRange {
+			if to, ok = dayNames[last[:min(len(last), 3)]]; !ok {
+				return nil, fmt.Errorf("bad weekday %q", last)
+			}
+		}
+		for d := from; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func parseFilters() (*filters, error) {
+	f := &filters{}
+	if businessHours != "" {
+		from, to, ok := strings.Cut(businessHours, "-")
+		if !ok {
+			return nil, usageError("bad business hours %q, want HH:MM-HH:MM", businessHours)
+		}
+		var err error
+		if f.from, err = parseClock(from); err != nil {
+			return nil, usageError("bad business hours: %v", err)
+		}
+		if f.to, err = parseClock(to); err != nil {
+			return nil, usageError("bad business hours: %v", err)
+		}
+		if f.to <= f.from {
+			return nil, usageError("business hours %q end before they start", businessHours)
+		}
+	}
+	if weekdays != "" {
+		var err error
+		if f.days, err = parseWeekdays(weekdays); err != nil {
+			return nil, usageError("bad weekdays: %v", err)
+		}
+	}
+	if outsideHours != "drop" && outsideHours != "demote" {
+		return nil, usageError("-outside-hours must be drop or demote, not %s", outsideHours)
+	}
+	if err := checkPrivateMode(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// keep reports whether an event is within the business hours and
+// weekdays. All-day events only have to be on the right day.
+func (f *filters) keep(ev *agendaEvent) bool {
+	if f.days != nil && !f.days[ev.Start.Weekday()] {
+		return false
+	}
+	if f.to == 0 || ev.AllDay {
+		return true
+	}
+	// Compare against the business hours on the day the event starts.
+	day := time.Date(ev.Start.Year(), ev.Start.Month(), ev.Start.Day(), 0, 0, 0, 0, ev.Start.Location())
+	open := day.Add(time.Duration(f.from) * time.Minute)
+	closed := day.Add(time.Duration(f.to) * time.Minute)
+	end := ev.End
+	if !end.After(ev.Start) {
+		end = ev.Start.Add(time.Minute)
+	}
+	return ev.Start.Before(closed) && end.After(open)
+}
+
+// applyFilters drops the events outside the business hours and weekdays,
+// or with -outside-hours demote, marks them so the formatters can play
+// them down. With -busy-only it also drops the events that leave us
+// free.
+func applyFilters(events []*agendaEvent) ([]*agendaEvent, error) {
+	f, err := parseFilters()
+	if err != nil {
+		return nil, err
+	}
+	kept := make([]*agendaEvent, 0, len(events))
+	for _, ev := range events {
+		if busyOnly && ev.Transparency == "transparent" {
+			log.Debugf("dropping free event %s", ev.Id)
+			continue
+		}
+		if f.keep(ev) {
+			kept = append(kept, ev)
+		} else if outsideHours == "demote" {
+			ev.Demoted = true
+			kept = append(kept, ev)
+		} else {
+			log.Debugf("dropping event %s outside business hours", ev.Id)
+		}
+	}
+	return kept, nil
+}
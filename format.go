@@ -0,0 +1,431 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A formatter writes a list of events in one output format.
+type formatter func(w io.Writer, events []*agendaEvent) error
+
+var formatters = map[string]formatter{
+	"remind":   formatRemind,
+	"org":      formatOrg,
+	"agenda":   formatAgenda,
+	"markdown": formatMarkdown,
+	"ics":      formatICS,
+	"json":     formatJSON,
+	"html":     formatHTML,
+}
+
+// formatExtensions are the file name extensions used with -output-dir.
+var formatExtensions = map[string]string{
+	"remind":   ".rem",
+	"org":      ".org",
+	"agenda":   ".txt",
+	"markdown": ".md",
+	"ics":      ".ics",
+	"json":     ".json",
+	"html":     ".html",
+}
+
+// summary is the event's summary, with the calendar's prefix if it has
+// one.
+func summary(ev *agendaEvent) string {
+	return ev.Settings.Prefix + strings.TrimSpace(ev.Summary)
+}
+
+// responseStatus is our answer to the event's invitation, or "" if we
+// weren't invited.
+func responseStatus(ev *agendaEvent) string {
+	for _, att := range ev.Attendees {
+		if att.Self {
+			return att.ResponseStatus
+		}
+	}
+	return ""
+}
+
+// responseMarkers tell pending invitations from meetings we're going to.
+var responseMarkers = map[string]string{
+	"tentative":   "[?] ",
+	"needsAction": "[INVITE] ",
+}
+
+// markedSummary is the summary with a marker for invitations we haven't
+// accepted, for the formats without a better way of showing them.
+func markedSummary(ev *agendaEvent) string {
+	return responseMarkers[responseStatus(ev)] + summary(ev)
+}
+
+// orgKeywords are the org TODO keywords for our answers to invitations.
+var orgKeywords = map[string]string{
+	"tentative":   "MAYBE ",
+	"needsAction": "INVITE ",
+}
+
+// demotedPriority is the remind priority of events outside business
+// hours, well below remind's default of 5000.
+const demotedPriority = 1000
+
+// remindPriority is the PRIORITY clause for the event's calendar, if
+// it has one.
+func remindPriority(ev *agendaEvent) string {
+	if ev.Demoted {
+		return fmt.Sprintf(" PRIORITY %d", demotedPriority)
+	}
+	if ev.Settings.Priority == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" PRIORITY %d", ev.Settings.Priority)
+}
+
+// orgTags is the tag list to end an org heading with, if any.
+func orgTags(ev *agendaEvent) string {
+	tags := make([]string, 0, 2)
+	switch ev.Kind {
+	case kindBirthday:
+		tags = append(tags, "BIRTHDAY")
+	case kindHoliday:
+		tags = append(tags, "HOLIDAY")
+	}
+	if ev.Buffer {
+		tags = append(tags, "buffer")
+	}
+	if ev.Demoted {
+		tags = append(tags, "offhours")
+	}
+	tags = append(tags, ev.Tags...)
+	if len(tags) == 0 {
+		return ""
+	}
+	return " :" + strings.Join(tags, ":") + ":"
+}
+
+// minutesPerDay is the lead time from which remind warns a day earlier
+// rather than some minutes earlier.
+const minutesPerDay = 24 * 60
+
+// remindDeltas are remind's day and time deltas for the event's
+// reminders: the day delta for the ones given days before, as "+N",
+// and for the others the time delta of the earliest, repeated so as to
+// go off at each of them, as "+N *M".
+func remindDeltas(ev *agendaEvent) (days, times string) {
+	var early int64
+	minutes := make([]int64, 0)
+	for _, rem := range ownReminders(ev) {
+		switch {
+		case rem.Minutes >= minutesPerDay || (ev.AllDay && rem.Minutes > 0):
+			early = max(early, rem.Minutes)
+		case rem.Minutes > 0:
+			minutes = append(minutes, rem.Minutes)
+		}
+	}
+	if early > 0 {
+		days = fmt.Sprintf(" +%d", (early+minutesPerDay-1)/minutesPerDay)
+	}
+	if len(minutes) == 0 || ev.AllDay {
+		return days, ""
+	}
+	first := slices.Max(minutes)
+	var every int64
+	for _, m := range minutes {
+		every = gcd(every, first-m)
+	}
+	times = fmt.Sprintf(" +%d", first)
+	if every > 0 {
+		times += fmt.Sprintf(" *%d", every)
+	}
+	return days, times
+}
+
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// remindCanSay tells the recurring events remind can have as they are.
+// Birthdays recur every year as it is.
+func remindCanSay(ev *agendaEvent) bool {
+	_, _, ok := remindSeries(ev)
+	return ev.Kind == kindBirthday || (ev.Kind == "" && ok)
+}
+
+func formatRemind(w io.Writer, events []*agendaEvent) error {
+	events, err := expandSeries(events, remindCanSay)
+	if err != nil {
+		return err
+	}
+	for _, ev := range events {
+		summary := markedSummary(ev)
+		if ev.Task {
+			fmt.Fprintf(w, "REM %s%s TAG gcal-%s%s MSG %%\"TODO: %s%%\" %%b\n",
+				remindTrigger(ev.Start), remindPriority(ev), ev.StableID(), remindTags(ev), summary)
+			continue
+		}
+		switch ev.Kind {
+		case kindHoliday:
+			// Holidays are days off rather than reminders, so that
+			// remind can skip them when counting working days.
+			layout := "Jan 02 2006"
+			if remindDate != "short" {
+				layout = remindDateLayouts[remindDate]
+			}
+			fmt.Fprintf(w, "OMIT %s MSG %s\n", ev.Start.Format(layout), summary)
+			continue
+		case kindBirthday:
+			// Without a year, so that it comes back every year.
+			days, _ := remindDeltas(ev)
+			fmt.Fprintf(w, "REM %s%s TAG gcal-%s%s SPECIAL COLOR 255 0 255 %s\n",
+				ev.Start.Format("Jan 02"), days, ev.StableID(), remindTags(ev), summary)
+			continue
+		}
+		trigger, satisfy := remindTrigger(ev.Start), ""
+		if len(ev.Recurrence) > 0 {
+			trigger, satisfy, _ = remindSeries(ev)
+		}
+		days, times := remindDeltas(ev)
+		fmt.Fprintf(w, "REM %s%s AT %02d:%02d%s%s TAG gcal-%s%s%s MSG %%\"%s%s%%\" %%b, %s\n",
+			trigger, days, ev.Start.Hour(), ev.Start.Minute(), times, remindPriority(ev),
+			ev.StableID(), remindTags(ev), satisfy, summary, alsoTimes(ev), remindAt())
+	}
+	return nil
+}
+
+// orgWarnTime is how many minutes before a timed event org's appt should
+// warn: its earliest reminder on the day, as appt only takes one and
+// only looks at the day's appointments.
+func orgWarnTime(ev *agendaEvent) int64 {
+	var warn int64
+	if ev.AllDay || ev.Task {
+		return 0
+	}
+	for _, rem := range ownReminders(ev) {
+		if rem.Minutes < minutesPerDay {
+			warn = max(warn, rem.Minutes)
+		}
+	}
+	return warn
+}
+
+func formatOrg(w io.Writer, events []*agendaEvent) error {
+	fmt.Fprintln(w, "# -*- mode: org -*-")
+	fmt.Fprintln(w, "#+TODO: TODO MAYBE INVITE | DONE")
+	events, err := expandSeries(events, func(ev *agendaEvent) bool {
+		_, ok := orgRepeater(ev)
+		return ok
+	})
+	if err != nil {
+		return err
+	}
+	stars := "*"
+	if orgStyle == "weektree" {
+		stars = "***"
+		events = sortedByStart(events)
+	}
+	var day time.Time
+	for i, ev := range events {
+		summary := summary(ev)
+		year, week := ev.Start.ISOWeek()
+		if orgStyle == "weektree" {
+			if dayYear, dayWeek := day.ISOWeek(); i == 0 || year != dayYear || week != dayWeek {
+				fmt.Fprintf(w, "* Week %d\n", week)
+			}
+			if i == 0 || !sameDay(ev.Start, day) {
+				fmt.Fprintf(w, "** %s\n", localDate(ev.Start, "2006-01-02 Monday"))
+			}
+			day = ev.Start
+		}
+		repeater, _ := orgRepeater(ev)
+		if ev.Task {
+			fmt.Fprintf(w, "%s TODO %s <%s>%s\n", stars, summary, ev.Start.Format("2006-01-02 Mon"), orgTags(ev))
+		} else if ev.Kind != "" {
+			fmt.Fprintf(w, "%s %s <%s%s>%s\n", stars, summary, ev.Start.Format("2006-01-02 Mon"), repeater, orgTags(ev))
+		} else {
+			fmt.Fprintf(w, "%s %s%s%s <%s%s>%s\n", stars, orgKeywords[responseStatus(ev)], summary, alsoTimes(ev),
+				ev.Start.Format("2006-01-02 Mon 15:04:05"), repeater, orgTags(ev))
+		}
+		fmt.Fprintf(w, "  :PROPERTIES:\n")
+		fmt.Fprintf(w, "  :GCAL_ID: %s\n", ev.StableID())
+		if ev.Settings.Category != "" {
+			fmt.Fprintf(w, "  :CATEGORY: %s\n", ev.Settings.Category)
+		}
+		if warn := orgWarnTime(ev); warn > 0 {
+			fmt.Fprintf(w, "  :APPT_WARNTIME: %d\n", warn)
+		}
+		fmt.Fprintf(w, "  :END:\n")
+		if ev.HtmlLink != "" {
+			fmt.Fprintf(w, "  [[%s][Open in calendar]]\n", ev.HtmlLink)
+		}
+		if orgStyle != "weektree" {
+			fmt.Fprintf(w, "  #+PROPERTY: week=%d\n", week)
+		}
+		// Add a property with the calendar name
+		if ev.Calendar != "" {
+			fmt.Fprintf(w, "  #+PROPERTY: calendar=%s\n", ev.Calendar)
+		}
+	}
+	return nil
+}
+
+// sortedByStart returns a copy of the events in start order, all-day
+// events first on each day, for the formats that group events by day.
+func sortedByStart(events []*agendaEvent) []*agendaEvent {
+	sorted := append([]*agendaEvent(nil), events...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if !sameDay(a.Start, b.Start) {
+			return a.Start.Before(b.Start)
+		}
+		if a.AllDay != b.AllDay {
+			return a.AllDay
+		}
+		return a.Start.Before(b.Start)
+	})
+	return sorted
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
+
+// formatAgenda writes a plain text agenda, one heading per day, for
+// reading in a terminal.
+func formatAgenda(w io.Writer, events []*agendaEvent) error {
+	now := time.Now()
+	var day time.Time
+	for i, ev := range sortedByStart(events) {
+		if i == 0 || !sameDay(ev.Start, day) {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			day = ev.Start
+			fmt.Fprintln(w, localDate(day, "Mon Jan 02"))
+		}
+		var when string
+		switch {
+		case ev.Task:
+			when = "todo"
+		case ev.AllDay:
+			when = "all day"
+		default:
+			when = ev.Start.Format("15:04") + "-" + ev.End.Format("15:04")
+		}
+		fmt.Fprintf(w, "  %-12s %s%s", when, markedSummary(ev), alsoTimes(ev))
+		if ev.Calendar != "" {
+			fmt.Fprintf(w, " [%s]", ev.Calendar)
+		}
+		if ev.Demoted {
+			fmt.Fprint(w, " (off hours)")
+		}
+		fmt.Fprintf(w, "%s\n", relativeNote(now, ev))
+	}
+	return nil
+}
+
+// formatMarkdown writes the agenda as a markdown list under a heading
+// per day, for notes and chat messages.
+func formatMarkdown(w io.Writer, events []*agendaEvent) error {
+	now := time.Now()
+	var day time.Time
+	for i, ev := range sortedByStart(events) {
+		if i == 0 || !sameDay(ev.Start, day) {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			day = ev.Start
+			fmt.Fprintf(w, "## %s\n\n", localDate(day, "Mon Jan 02"))
+		}
+		fmt.Fprint(w, "- ")
+		switch {
+		case ev.Task:
+			fmt.Fprint(w, "[ ] ")
+		case ev.AllDay:
+		default:
+			fmt.Fprintf(w, "**%s-%s** ", ev.Start.Format("15:04"), ev.End.Format("15:04"))
+		}
+		text := markdownEscape(markedSummary(ev))
+		if ev.HtmlLink != "" {
+			text = "[" + text + "](" + ev.HtmlLink + ")"
+		}
+		text += alsoTimes(ev)
+		if ev.Demoted {
+			text = "_" + text + "_"
+		}
+		fmt.Fprint(w, text)
+		if ev.Calendar != "" {
+			fmt.Fprintf(w, " · %s", markdownEscape(ev.Calendar))
+		}
+		fmt.Fprintf(w, "%s\n", relativeNote(now, ev))
+	}
+	return nil
+}
+
+// markdownEscape keeps event text from being taken for markdown markup.
+var markdownEscape = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`,
+	"<", `\<`, ">", `\>`, "#", `\#`,
+).Replace
+
+// jsonEvent is how events look in the json format.
+type jsonEvent struct {
+	ID          string    `json:"id"`
+	Summary     string    `json:"summary"`
+	Calendar    string    `json:"calendar"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	AllDay      bool      `json:"all_day"`
+	Task        bool      `json:"task,omitempty"`
+	Kind        string    `json:"kind,omitempty"`
+	Demoted     bool      `json:"demoted,omitempty"`
+	Buffer      bool      `json:"buffer,omitempty"`
+	Location    string    `json:"location,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Status      string    `json:"status,omitempty"`
+	Response    string    `json:"response,omitempty"`
+	Busy        bool      `json:"busy"`
+	Visibility  string    `json:"visibility,omitempty"`
+	Link        string    `json:"link,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+}
+
+func newJSONEvent(ev *agendaEvent) *jsonEvent {
+	return &jsonEvent{
+		ID:          ev.StableID(),
+		Summary:     summary(ev),
+		Calendar:    ev.Calendar,
+		Start:       ev.Start,
+		End:         ev.End,
+		AllDay:      ev.AllDay,
+		Task:        ev.Task,
+		Kind:        ev.Kind,
+		Demoted:     ev.Demoted,
+		Buffer:      ev.Buffer,
+		Location:    ev.Location,
+		Description: ev.Description,
+		Status:      ev.Status,
+		Response:    responseStatus(ev),
+		Busy:        ev.Transparency != "transparent",
+		Visibility:  ev.Visibility,
+		Link:        ev.HtmlLink,
+		Tags:        ev.Tags,
+	}
+}
+
+// formatJSON writes the events as a JSON array, in start order.
+func formatJSON(w io.Writer, events []*agendaEvent) error {
+	list := make([]*jsonEvent, 0, len(events))
+	for _, ev := range sortedByStart(events) {
+		list = append(list, newJSONEvent(ev))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(list)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files with what the formatters write now")
+
+// replayEvents reads the events saved in testdata/replay, as gcal
+// -replay testdata/replay would.
+func replayEvents(t *testing.T) []*agendaEvent {
+	t.Helper()
+	localzone, err := localZone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	p := replayProvider{filepath.Join("testdata", "replay")}
+	list, err := p.Calendars(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := collectEvents(ctx, p, selectCalendars(list), duration, localzone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// unstable are the parts of the output that change from run to run.
+var unstable = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`DTSTAMP:\d{8}T\d{6}Z`), "DTSTAMP:<now>"},
+	{regexp.MustCompile(`"uuid": "[0-9a-f-]{36}"`), `"uuid": "<uuid>"`},
+}
+
+// TestFormats runs every format over the replayed events and compares
+// the output with testdata/golden. Run go test -update after changing a
+// format on purpose.
+func TestFormats(t *testing.T) {
+	events := replayEvents(t)
+	// The table is as wide as $COLUMNS when it isn't on a terminal.
+	t.Setenv("COLUMNS", "100")
+	// Taskwarrior UUIDs are kept in the cache.
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	twUUIDs.m = nil
+	t.Cleanup(func() { twUUIDs.m = nil })
+
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := formatters[name](&buf, events); err != nil {
+				t.Fatal(err)
+			}
+			got := buf.Bytes()
+			for _, u := range unstable {
+				got = u.re.ReplaceAll(got, []byte(u.repl))
+			}
+			golden := filepath.Join("testdata", "golden", name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s output differs from %s:\n%s", name, golden, unifiedDiff(golden, string(want), string(got)))
+			}
+		})
+	}
+}
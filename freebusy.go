@@ -0,0 +1,64 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// interval is a span of time, from Start up to but not including End.
+type interval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// busyIntervals merges the meetings among the events into the times we
+// are busy, in order and without overlaps.
+func busyIntervals(events []*agendaEvent) []interval {
+	busy := make([]interval, 0, len(events))
+	for _, ev := range events {
+		if isMeeting(ev) && ev.End.After(ev.Start) {
+			busy = append(busy, interval{ev.Start, ev.End})
+		}
+	}
+	return mergeIntervals(busy)
+}
+
+// mergeIntervals sorts the intervals and merges those that overlap or
+// touch.
+func mergeIntervals(busy []interval) []interval {
+	sort.Slice(busy, func(i, j int) bool { return busy[i].Start.Before(busy[j].Start) })
+	merged := make([]interval, 0, len(busy))
+	for _, iv := range busy {
+		if n := len(merged); n > 0 && !iv.Start.After(merged[n-1].End) {
+			if iv.End.After(merged[n-1].End) {
+				merged[n-1].End = iv.End
+			}
+			continue
+		}
+		merged = append(merged, iv)
+	}
+	return merged
+}
+
+// freeIntervals are the gaps of at least min between the busy intervals,
+// which must be merged, within span.
+func freeIntervals(busy []interval, span interval, min time.Duration) []interval {
+	free := make([]interval, 0)
+	start := span.Start
+	for _, iv := range busy {
+		if !iv.End.After(start) {
+			continue
+		}
+		if !iv.Start.Before(span.End) {
+			break
+		}
+		if iv.Start.Sub(start) >= min {
+			free = append(free, interval{start, iv.Start})
+		}
+		start = iv.End
+	}
+	if span.End.Sub(start) >= min {
+		free = append(free, interval{start, span.End})
+	}
+	return free
+}
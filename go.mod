@@ -4,7 +4,9 @@ go 1.23.4
 
 require (
 	github.com/op/go-logging v0.0.0-20160315200505-970db520ece7
+	golang.org/x/crypto v0.31.0
 	golang.org/x/oauth2 v0.25.0
+	golang.org/x/term v0.27.0
 	google.golang.org/api v0.214.0
 )
 
@@ -23,7 +25,6 @@ require (
 	go.opentelemetry.io/otel v1.29.0 // indirect
 	go.opentelemetry.io/otel/metric v1.29.0 // indirect
 	go.opentelemetry.io/otel/trace v1.29.0 // indirect
-	golang.org/x/crypto v0.31.0 // indirect
 	golang.org/x/net v0.33.0 // indirect
 	golang.org/x/sys v0.28.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"time"
+)
+
+type htmlEvent struct {
+	When     string
+	Summary  string
+	Calendar string
+	Location string
+	Link     string
+	Note     string
+	Demoted  bool
+}
+
+type htmlDay struct {
+	Date   string
+	Events []htmlEvent
+}
+
+var htmlTemplate = template.Must(template.New("html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Agenda</title>
+<style>
+body { font-family: sans-serif; }
+h2 { font-size: 1.1em; margin: 1em 0 0.3em; }
+td { padding: 0.15em 0.6em 0.15em 0; vertical-align: top; }
+.when { white-space: nowrap; font-variant-numeric: tabular-nums; }
+.calendar, .note { color: #777; }
+.demoted { color: #999; }
+</style>
+</head>
+<body>
+{{- range .}}
+<h2>{{.Date}}</h2>
+<table>
+{{- range .Events}}
+<tr{{if .Demoted}} class="demoted"{{end}}><td class="when">{{.When}}</td><td>
+{{- if .Link}}<a href="{{.Link}}">{{.Summary}}</a>{{else}}{{.Summary}}{{end}}
+{{- if .Location}}<br><small>{{.Location}}</small>{{end}}</td>
+<td class="calendar">{{.Calendar}}</td><td class="note">{{.Note}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p>Nothing scheduled.</p>
+{{- end}}
+</body>
+</html>
+`))
+
+// htmlDays groups the events by day for the html template.
+func htmlDays(events []*agendaEvent) []htmlDay {
+	now := time.Now()
+	days := make([]htmlDay, 0)
+	for _, ev := range sortedByStart(events) {
+		if n := len(days); n == 0 || days[n-1].Date != localDate(ev.Start, "Mon Jan 02") {
+			days = append(days, htmlDay{Date: localDate(ev.Start, "Mon Jan 02")})
+		}
+		when := ev.Start.Format("15:04") + "–" + ev.End.Format("15:04")
+		if ev.Task {
+			when = "todo"
+		} else if ev.AllDay {
+			when = "all day"
+		}
+		day := &days[len(days)-1]
+		day.Events = append(day.Events, htmlEvent{
+			When:     when,
+			Summary:  markedSummary(ev) + alsoTimes(ev),
+			Calendar: ev.Calendar,
+			Location: ev.Location,
+			Link:     ev.HtmlLink,
+			Note:     relativeNote(now, ev),
+			Demoted:  ev.Demoted,
+		})
+	}
+	return days
+}
+
+// formatHTML writes the agenda as a web page, one table per day.
+func formatHTML(w io.Writer, events []*agendaEvent) error {
+	return htmlTemplate.Execute(w, htmlDays(events))
+}
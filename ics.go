@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// icsProperty is one content line of an iCalendar file (RFC 5545), e.g.
+// DTSTART;TZID=America/Montreal:20250105T100000.
+type icsProperty struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// icsComponent is a BEGIN/END block, e.g. a VEVENT.
+type icsComponent struct {
+	Name       string
+	Properties []*icsProperty
+	Components []*icsComponent
+}
+
+// get returns the first property with the given name, or nil.
+func (c *icsComponent) get(name string) *icsProperty {
+	for _, p := range c.Properties {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// text returns the unescaped value of a text property, or "".
+func (c *icsComponent) text(name string) string {
+	p := c.get(name)
+	if p == nil {
+		return ""
+	}
+	return icsUnescape(p.Value)
+}
+
+// icsCalendar is what we get out of an iCalendar file.
+type icsCalendar struct {
+	Name   string
+	Events []*calendar.Event
+}
+
+// unfoldICS reads the logical lines of an iCalendar stream, joining the
+// continuation lines that start with a space or tab.
+func unfoldICS(r io.Reader) ([]string, error) {
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// parseICSLine splits a content line into name, parameters and value,
+// minding quoted parameter values which may contain ':' and ';'.
+func parseICSLine(line string) (*icsProperty, error) {
+	p := &icsProperty{Params: map[string]string{}}
+	i := strings.IndexAny(line, ";:")
+	if i < 0 {
+		return nil, fmt.Errorf("malformed line %q", line)
+	}
+	p.Name = strings.ToUpper(line[:i])
+	for line[i] == ';' {
+		line = line[i+1:]
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("malformed parameter in %q", line)
+		}
+		pname := strings.ToUpper(line[:eq])
+		line = line[eq+1:]
+		var pvalue string
+		if strings.HasPrefix(line, `"`) {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote in %q", line)
+			}
+			pvalue = line[1 : end+1]
+			line = line[end+2:]
+			i = 0
+		} else {
+			i = strings.IndexAny(line, ";:")
+			if i < 0 {
+				return nil, fmt.Errorf("malformed parameter in %q", line)
+			}
+			pvalue = line[:i]
+			line = line[i:]
+			i = 0
+		}
+		p.Params[pname] = pvalue
+		if line == "" {
+			return nil, fmt.Errorf("missing value for %s", p.Name)
+		}
+	}
+	p.Value = line[i+1:]
+	return p, nil
+}
+
+// parseICSComponents parses an iCalendar stream into its top level
+// components, normally a single VCALENDAR.
+func parseICSComponents(r io.Reader) ([]*icsComponent, error) {
+	lines, err := unfoldICS(r)
+	if err != nil {
+		return nil, err
+	}
+	top := &icsComponent{}
+	stack := []*icsComponent{top}
+	for n, line := range lines {
+		p, err := parseICSLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		cur := stack[len(stack)-1]
+		switch p.Name {
+		case "BEGIN":
+			c := &icsComponent{Name: strings.ToUpper(p.Value)}
+			cur.Components = append(cur.Components, c)
+			stack = append(stack, c)
+		case "END":
+			if len(stack) == 1 || cur.Name != strings.ToUpper(p.Value) {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", n+1, p.Value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			cur.Properties = append(cur.Properties, p)
+		}
+	}
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("unterminated %s", stack[len(stack)-1].Name)
+	}
+	return top.Components, nil
+}
+
+// parseICS reads the events of an iCalendar stream. Events that cannot be
+// understood are skipped with a warning, or fail the parse with -strict.
+func parseICS(r io.Reader, localzone *time.Location) (*icsCalendar, error) {
+	components, err := parseICSComponents(r)
+	if err != nil {
+		return nil, err
+	}
+	cal := &icsCalendar{Events: make([]*calendar.Event, 0)}
+	for _, vcal := range components {
+		if vcal.Name != "VCALENDAR" {
+			continue
+		}
+		if cal.Name == "" {
+			cal.Name = vcal.text("X-WR-CALNAME")
+		}
+		for _, c := range vcal.Components {
+			if c.Name != "VEVENT" {
+				continue
+			}
+			ev, err := icsEvent(c, localzone)
+			if err != nil {
+				err = fmt.Errorf("event %s: %w", c.text("UID"), err)
+				if strict {
+					return nil, err
+				}
+				log.Warningf("skipping %v", err)
+				continue
+			}
+			cal.Events = append(cal.Events, ev)
+		}
+	}
+	return cal, nil
+}
+
+var icsUnescaper = strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+
+func icsUnescape(s string) string {
+	return icsUnescaper.Replace(s)
+}
+
+// icsTime parses a DATE or DATE-TIME property. Times with a TZID we
+// don't know, and floating times, are taken to be local.
+func icsTime(p *icsProperty, localzone *time.Location) (time.Time, bool, error) {
+	if p.Params["VALUE"] == "DATE" || len(p.Value) == 8 {
+		t, err := time.ParseInLocation("20060102", p.Value, localzone)
+		return t, true, err
+	}
+	if strings.HasSuffix(p.Value, "Z") {
+		t, err := time.Parse("20060102T150405Z", p.Value)
+		return t, false, err
+	}
+	loc := localzone
+	if tzid := p.Params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(strings.TrimPrefix(tzid, "/")); err == nil {
+			loc = l
+		} else {
+			log.Debugf("unknown TZID %q, assuming local time", tzid)
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", p.Value, loc)
+	return t, false, err
+}
+
+// eventDateTime converts a parsed time to the Google representation.
+func eventDateTime(t time.Time, allday bool) *calendar.EventDateTime {
+	if allday {
+		return &calendar.EventDateTime{Date: t.Format("2006-01-02")}
+	}
+	return &calendar.EventDateTime{DateTime: t.Format(time.RFC3339)}
+}
+
+// parseICSDuration parses an RFC 5545 duration such as -PT15M or P1DT2H.
+func parseICSDuration(s string) (time.Duration, error) {
+	orig := s
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+		s = s[1:]
+	}
+	s = strings.TrimPrefix(s, "+")
+	if !strings.HasPrefix(s, "P") {
+		return 0, fmt.Errorf("bad duration %q", orig)
+	}
+	s = s[1:]
+	var d time.Duration
+	intime := false
+	for s != "" {
+		if s[0] == 'T' {
+			intime = true
+			s = s[1:]
+			continue
+		}
+		i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+		if i <= 0 {
+			return 0, fmt.Errorf("bad duration %q", orig)
+		}
+		n, _ := strconv.Atoi(s[:i])
+		unit := map[bool]map[byte]time.Duration{
+			false: {'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour},
+			true:  {'H': time.Hour, 'M': time.Minute, 'S': time.Second},
+		}[intime][s[i]]
+		if unit == 0 {
+			return 0, fmt.Errorf("bad duration %q", orig)
+		}
+		d += time.Duration(n) * unit
+		s = s[i+1:]
+	}
+	return sign * d, nil
+}
+
+// icsStatuses maps iCalendar values to the Google ones.
+var icsStatuses = map[string]string{
+	"CONFIRMED":    "confirmed",
+	"TENTATIVE":    "tentative",
+	"CANCELLED":    "cancelled",
+	"ACCEPTED":     "accepted",
+	"DECLINED":     "declined",
+	"NEEDS-ACTION": "needsAction",
+	"OPAQUE":       "opaque",
+	"TRANSPARENT":  "transparent",
+	"PUBLIC":       "public",
+	"PRIVATE":      "private",
+	"CONFIDENTIAL": "confidential",
+}
+
+// icsEvent converts a VEVENT into the Google shape.
+func icsEvent(c *icsComponent, localzone *time.Location) (*calendar.Event, error) {
+	dtstart := c.get("DTSTART")
+	if dtstart == nil {
+		return nil, fmt.Errorf("no DTSTART")
+	}
+	start, allday, err := icsTime(dtstart, localzone)
+	if err != nil {
+		return nil, fmt.Errorf("bad DTSTART: %w", err)
+	}
+	end := start
+	if allday {
+		end = start.AddDate(0, 0, 1)
+	}
+	if dtend := c.get("DTEND"); dtend != nil {
+		if end, _, err = icsTime(dtend, localzone); err != nil {
+			return nil, fmt.Errorf("bad DTEND: %w", err)
+		}
+	} else if dur := c.get("DURATION"); dur != nil {
+		d, err := parseICSDuration(dur.Value)
+		if err != nil {
+			return nil, err
+		}
+		end = start.Add(d)
+	}
+
+	uid := c.text("UID")
+	ev := &calendar.Event{
+		Id:           uid,
+		ICalUID:      uid,
+		Summary:      c.text("SUMMARY"),
+		Description:  c.text("DESCRIPTION"),
+		Location:     c.text("LOCATION"),
+		HtmlLink:     c.text("URL"),
+		Start:        eventDateTime(start, allday),
+		End:          eventDateTime(end, allday),
+		Status:       icsStatuses[strings.ToUpper(c.text("STATUS"))],
+		Transparency: icsStatuses[strings.ToUpper(c.text("TRANSP"))],
+		Visibility:   icsStatuses[strings.ToUpper(c.text("CLASS"))],
+	}
+	if ev.Status == "" {
+		ev.Status = "confirmed"
+	}
+	if !allday && start.Location() != time.UTC {
+		ev.Start.TimeZone = start.Location().String()
+	}
+	if seq := c.get("SEQUENCE"); seq != nil {
+		ev.Sequence, _ = strconv.ParseInt(seq.Value, 10, 64)
+	}
+	for _, p := range c.Properties {
+		switch p.Name {
+		case "RRULE", "RDATE", "EXDATE":
+			ev.Recurrence = append(ev.Recurrence, icsPropertyString(p))
+		case "RECURRENCE-ID":
+			t, tallday, err := icsTime(p, localzone)
+			if err != nil {
+				return nil, fmt.Errorf("bad RECURRENCE-ID: %w", err)
+			}
+			ev.OriginalStartTime = eventDateTime(t, tallday)
+			ev.RecurringEventId = uid
+			// Instances share the UID of their series, so make the id
+			// unique the way Google does.
+			ev.Id = uid + "_" + t.UTC().Format("20060102T150405Z")
+		case "ORGANIZER":
+			ev.Organizer = &calendar.EventOrganizer{
+				DisplayName: p.Params["CN"],
+				Email:       mailtoAddress(p.Value),
+			}
+		case "ATTENDEE":
+			ev.Attendees = append(ev.Attendees, &calendar.EventAttendee{
+				DisplayName:    p.Params["CN"],
+				Email:          mailtoAddress(p.Value),
+				ResponseStatus: icsStatuses[strings.ToUpper(p.Params["PARTSTAT"])],
+				Optional:       p.Params["ROLE"] == "OPT-PARTICIPANT",
+			})
+		case "ATTACH":
+			// Only links; inline files are left out.
+			if p.Params["VALUE"] == "BINARY" || p.Params["ENCODING"] == "BASE64" {
+				continue
+			}
+			title := p.Params["FILENAME"]
+			if title == "" {
+				title = p.Params["X-APPLE-FILENAME"]
+			}
+			if title == "" {
+				title = path.Base(strings.TrimRight(p.Value, "/"))
+			}
+			ev.Attachments = append(ev.Attachments, &calendar.EventAttachment{
+				Title:    title,
+				FileUrl:  p.Value,
+				MimeType: p.Params["FMTTYPE"],
+			})
+		case "CREATED":
+			if t, _, err := icsTime(p, localzone); err == nil {
+				ev.Created = t.UTC().Format(time.RFC3339)
+			}
+		case "LAST-MODIFIED":
+			if t, _, err := icsTime(p, localzone); err == nil {
+				ev.Updated = t.UTC().Format(time.RFC3339)
+			}
+		}
+	}
+	for _, alarm := range c.Components {
+		if alarm.Name != "VALARM" {
+			continue
+		}
+		trigger := alarm.get("TRIGGER")
+		if trigger == nil || trigger.Params["VALUE"] == "DATE-TIME" {
+			continue
+		}
+		d, err := parseICSDuration(trigger.Value)
+		if err != nil || d > 0 {
+			continue
+		}
+		if ev.Reminders == nil {
+			ev.Reminders = &calendar.EventReminders{}
+		}
+		method := "popup"
+		if strings.EqualFold(alarm.text("ACTION"), "EMAIL") {
+			method = "email"
+		}
+		ev.Reminders.Overrides = append(ev.Reminders.Overrides, &calendar.EventReminder{
+			Method:  method,
+			Minutes: int64(-d / time.Minute),
+		})
+	}
+	return ev, nil
+}
+
+// icsPropertyString turns a property back into its content line, for the
+// Recurrence field, which holds RRULE and friends in that form.
+func icsPropertyString(p *icsProperty) string {
+	var sb strings.Builder
+	sb.WriteString(p.Name)
+	names := make([]string, 0, len(p.Params))
+	for name := range p.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&sb, ";%s=%s", name, p.Params[name])
+	}
+	sb.WriteString(":")
+	sb.WriteString(p.Value)
+	return sb.String()
+}
+
+func mailtoAddress(s string) string {
+	if len(s) > 7 && strings.EqualFold(s[:7], "mailto:") {
+		return s[7:]
+	}
+	return s
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseICSLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		name   string
+		params map[string]string
+		value  string
+	}{
+		{"SUMMARY:Lunch", "SUMMARY", map[string]string{}, "Lunch"},
+		{"dtstart;tzid=America/Montreal:20250305T100000", "DTSTART", map[string]string{"TZID": "America/Montreal"}, "20250305T100000"},
+		{`ATTENDEE;CN="Doe; Jane: PhD";PARTSTAT=ACCEPTED:mailto:jane@example.com`, "ATTENDEE",
+			map[string]string{"CN": "Doe; Jane: PhD", "PARTSTAT": "ACCEPTED"}, "mailto:jane@example.com"},
+		{"DESCRIPTION:", "DESCRIPTION", map[string]string{}, ""},
+	}
+	for _, tt := range tests {
+		p, err := parseICSLine(tt.line)
+		if err != nil {
+			t.Errorf("parseICSLine(%q): %v", tt.line, err)
+			continue
+		}
+		if p.Name != tt.name || p.Value != tt.value || len(p.Params) != len(tt.params) {
+			t.Errorf("parseICSLine(%q) = %+v", tt.line, p)
+			continue
+		}
+		for k, v := range tt.params {
+			if p.Params[k] != v {
+				t.Errorf("parseICSLine(%q): %s is %q, want %q", tt.line, k, p.Params[k], v)
+			}
+		}
+	}
+	for _, line := range []string{"SUMMARY", `ATTENDEE;CN="Jane:mailto:jane@example.com`, "DTSTART;TZID", "DTSTART;VALUE=DATE"} {
+		if p, err := parseICSLine(line); err == nil {
+			t.Errorf("parseICSLine(%q) = %+v, want an error", line, p)
+		}
+	}
+}
+
+func TestParseICSDuration(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Duration
+	}{
+		{"PT15M", 15 * time.Minute},
+		{"-PT15M", -15 * time.Minute},
+		{"+P1DT2H", 26 * time.Hour},
+		{"P1W", 7 * 24 * time.Hour},
+		{"PT1H30M10S", time.Hour + 30*time.Minute + 10*time.Second},
+		{"P0D", 0},
+	}
+	for _, tt := range tests {
+		got, err := parseICSDuration(tt.s)
+		if err != nil || got != tt.want {
+			t.Errorf("parseICSDuration(%q) = %v, %v; want %v", tt.s, got, err, tt.want)
+		}
+	}
+	for _, s := range []string{"15M", "P1H", "PT1D", "P-1D", "PTM"} {
+		if got, err := parseICSDuration(s); err == nil {
+			t.Errorf("parseICSDuration(%q) = %v, want an error", s, got)
+		}
+	}
+}
+
+// testICS has one of everything parseICS reads, folded and with CRLF
+// line ends as servers send them.
+const testICS = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"X-WR-CALNAME:Team\\, East\r\n" +
+	"BEGIN:VTIMEZONE\r\n" +
+	"TZID:America/Montreal\r\n" +
+	"END:VTIMEZONE\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:weekly@example.com\r\n" +
+	"DTSTART;TZID=America/Montreal:20250303T100000\r\n" +
+	"DURATION:PT30M\r\n" +
+	"RRULE:FREQ=WEEKLY;BYDAY=MO\r\n" +
+	"EXDATE;TZID=America/Montreal:20250310T100000\r\n" +
+	"SUMMARY:Planning\\; weekly\r\n" +
+	"DESCRIPTION:Agenda:\\n- status\\n- next st\r\n" +
+	" eps\r\n" +
+	"ORGANIZER;CN=Boss:mailto:boss@example.com\r\n" +
+	"ATTENDEE;CN=\"Doe, Jane\";PARTSTAT=TENTATIVE;ROLE=OPT-PARTICIPANT:MAILTO:jane@example.com\r\n" +
+	"ATTACH;FMTTYPE=application/pdf:https://example.com/files/plan.pdf\r\n" +
+	"ATTACH;ENCODING=BASE64;VALUE=BINARY:aGVsbG8=\r\n" +
+	"CLASS:PRIVATE\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"ACTION:DISPLAY\r\n" +
+	"TRIGGER:-PT10M\r\n" +
+	"END:VALARM\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"ACTION:EMAIL\r\n" +
+	"TRIGGER:-P1D\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:weekly@example.com\r\n" +
+	"RECURRENCE-ID;TZID=America/Montreal:20250317T100000\r\n" +
+	"DTSTART:20250318T140000Z\r\n" +
+	"DTEND:20250318T143000Z\r\n" +
+	"SUMMARY:Planning (moved)\r\n" +
+	"STATUS:TENTATIVE\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:holiday@example.com\r\n" +
+	"DTSTART;VALUE=DATE:20250317\r\n" +
+	"SUMMARY:Holiday\r\n" +
+	"TRANSP:TRANSPARENT\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:broken@example.com\r\n" +
+	"SUMMARY:No start\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseICS(t *testing.T) {
+	localzone := testNow(t).Location()
+	cal, err := parseICS(strings.NewReader(testICS), localzone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cal.Name != "Team, East" {
+		t.Errorf("got calendar name %q", cal.Name)
+	}
+	// The event without a start is skipped.
+	if len(cal.Events) != 3 {
+		t.Fatalf("got %d events, want 3", len(cal.Events))
+	}
+
+	weekly := cal.Events[0]
+	if weekly.Id != "weekly@example.com" || weekly.Summary != "Planning; weekly" {
+		t.Errorf("got event %q, %q", weekly.Id, weekly.Summary)
+	}
+	if weekly.Description != "Agenda:\n- status\n- next steps" {
+		t.Errorf("got description %q", weekly.Description)
+	}
+	if weekly.Start.DateTime != "2025-03-03T10:00:00-05:00" || weekly.Start.TimeZone != "America/Montreal" ||
+		weekly.End.DateTime != "2025-03-03T10:30:00-05:00" {
+		t.Errorf("got %+v to %+v", weekly.Start, weekly.End)
+	}
+	if got := strings.Join(weekly.Recurrence, "|"); got != "RRULE:FREQ=WEEKLY;BYDAY=MO|EXDATE;TZID=America/Montreal:20250310T100000" {
+		t.Errorf("got recurrence %q", got)
+	}
+	if weekly.Organizer == nil || weekly.Organizer.Email != "boss@example.com" || weekly.Organizer.DisplayName != "Boss" {
+		t.Errorf("got organizer %+v", weekly.Organizer)
+	}
+	if len(weekly.Attendees) != 1 {
+		t.Fatalf("got %d attendees, want 1", len(weekly.Attendees))
+	}
+	if att := weekly.Attendees[0]; att.Email != "jane@example.com" || att.DisplayName != "Doe, Jane" ||
+		att.ResponseStatus != "tentative" || !att.Optional {
+		t.Errorf("got attendee %+v", att)
+	}
+	if len(weekly.Attachments) != 1 || weekly.Attachments[0].Title != "plan.pdf" ||
+		weekly.Attachments[0].MimeType != "application/pdf" {
+		t.Errorf("got attachments %+v", weekly.Attachments)
+	}
+	if weekly.Visibility != "private" || weekly.Status != "confirmed" {
+		t.Errorf("got visibility %q and status %q", weekly.Visibility, weekly.Status)
+	}
+	if weekly.Reminders == nil || len(weekly.Reminders.Overrides) != 2 ||
+		weekly.Reminders.Overrides[0].Method != "popup" || weekly.Reminders.Overrides[0].Minutes != 10 ||
+		weekly.Reminders.Overrides[1].Method != "email" || weekly.Reminders.Overrides[1].Minutes != 24*60 {
+		t.Errorf("got reminders %+v", weekly.Reminders)
+	}
+
+	moved := cal.Events[1]
+	if moved.Id != "weekly@example.com_20250317T140000Z" || moved.RecurringEventId != "weekly@example.com" {
+		t.Errorf("got moved instance %q of %q", moved.Id, moved.RecurringEventId)
+	}
+	if moved.OriginalStartTime == nil || moved.OriginalStartTime.DateTime != "2025-03-17T10:00:00-04:00" {
+		t.Errorf("got original start %+v", moved.OriginalStartTime)
+	}
+	if moved.Start.DateTime != "2025-03-18T14:00:00Z" || moved.Start.TimeZone != "" || moved.Status != "tentative" {
+		t.Errorf("got start %+v and status %q", moved.Start, moved.Status)
+	}
+
+	// An all-day event without an end lasts the day.
+	holiday := cal.Events[2]
+	if holiday.Start.Date != "2025-03-17" || holiday.End.Date != "2025-03-18" || holiday.Transparency != "transparent" {
+		t.Errorf("got %+v to %+v, %q", holiday.Start, holiday.End, holiday.Transparency)
+	}
+}
+
+func TestParseICSStrict(t *testing.T) {
+	strict = true
+	t.Cleanup(func() { strict = false })
+	if _, err := parseICS(strings.NewReader(testICS), testNow(t).Location()); err == nil {
+		t.Error("got no error for the event without a start")
+	}
+}
+
+func TestParseICSMalformed(t *testing.T) {
+	for _, s := range []string{
+		"BEGIN:VCALENDAR\nBEGIN:VEVENT\nEND:VCALENDAR\n",
+		"BEGIN:VCALENDAR\nBEGIN:VEVENT\nEND:VEVENT\n",
+		"END:VCALENDAR\n",
+		"BEGIN:VCALENDAR\nnot a content line\nEND:VCALENDAR\n",
+	} {
+		if _, err := parseICS(strings.NewReader(s), time.UTC); err == nil {
+			t.Errorf("parseICS(%q): got no error", s)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+var (
+	icsAlarms bool
+	icsAlarm  time.Duration
+)
+
+func init() {
+	flag.BoolVar(&icsAlarms, "alarms", false, "Add VALARMs for the events' reminders in the ics format")
+	flag.DurationVar(&icsAlarm, "alarm", 0, "Alarm before events without reminders of their own in the ics format, e.g. 10m (implies -alarms)")
+}
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", "")
+
+func icsEscape(s string) string {
+	return icsEscaper.Replace(s)
+}
+
+// icsLine writes a content line, folded at 75 octets as RFC 5545 asks,
+// without splitting UTF-8 sequences.
+func icsLine(w io.Writer, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		fmt.Fprintf(w, "%s\r\n ", line[:cut])
+		line = line[cut:]
+		// The space a continuation starts with counts towards its length.
+		limit = 74
+	}
+	fmt.Fprintf(w, "%s\r\n", line)
+}
+
+// icsDate is a DATE or UTC DATE-TIME property.
+func icsDate(name string, t time.Time, allday bool) string {
+	if allday {
+		return name + ";VALUE=DATE:" + t.Format("20060102")
+	}
+	return name + ":" + t.UTC().Format("20060102T150405Z")
+}
+
+// icsTrigger is the TRIGGER value for an alarm the given number of
+// minutes before the start, such as -PT10M or -P1DT2H.
+func icsTrigger(minutes int64) string {
+	if minutes == 0 {
+		return "PT0S"
+	}
+	var sb strings.Builder
+	sb.WriteString("-P")
+	if days := minutes / (24 * 60); days > 0 {
+		fmt.Fprintf(&sb, "%dD", days)
+		minutes %= 24 * 60
+	}
+	if minutes > 0 {
+		sb.WriteString("T")
+		if h := minutes / 60; h > 0 {
+			fmt.Fprintf(&sb, "%dH", h)
+		}
+		if m := minutes % 60; m > 0 {
+			fmt.Fprintf(&sb, "%dM", m)
+		}
+	}
+	return sb.String()
+}
+
+// ownReminders are the reminders the provider would give for the event:
+// its overrides, or its calendar's defaults.
+func ownReminders(ev *agendaEvent) []*calendar.EventReminder {
+	if ev.Reminders == nil {
+		return nil
+	}
+	if len(ev.Reminders.Overrides) > 0 {
+		return ev.Reminders.Overrides
+	}
+	if ev.Reminders.UseDefault {
+		return ev.DefaultReminders
+	}
+	return nil
+}
+
+// eventReminders are the reminders to turn into alarms: the event's own,
+// or failing them the -alarm one.
+func eventReminders(ev *agendaEvent) []*calendar.EventReminder {
+	if !icsAlarms && icsAlarm == 0 {
+		return nil
+	}
+	if reminders := ownReminders(ev); len(reminders) > 0 {
+		return reminders
+	}
+	if icsAlarm > 0 {
+		return []*calendar.EventReminder{{Method: "popup", Minutes: int64(icsAlarm / time.Minute)}}
+	}
+	return nil
+}
+
+// icsPartstats are the PARTSTATs for our answers to invitations.
+var icsPartstats = map[string]string{
+	"accepted":    "ACCEPTED",
+	"declined":    "DECLINED",
+	"tentative":   "TENTATIVE",
+	"needsAction": "NEEDS-ACTION",
+}
+
+// icsUID is the event's UID: the provider's iCalendar UID, or one made
+// up from our own id for events that don't have one.
+func icsUID(ev *agendaEvent) string {
+	if ev.ICalUID != "" {
+		return ev.ICalUID
+	}
+	return ev.StableID() + "@gcal"
+}
+
+// formatICS writes the events as an iCalendar file, for importing into
+// other calendar programs.
+func formatICS(w io.Writer, events []*agendaEvent) error {
+	now := time.Now()
+	icsLine(w, "BEGIN:VCALENDAR")
+	icsLine(w, "VERSION:2.0")
+	icsLine(w, "PRODID:-//msoulier//gcal//EN")
+	icsLine(w, "CALSCALE:GREGORIAN")
+	if name := commonCalendar(events); name != "" {
+		icsLine(w, "X-WR-CALNAME:"+icsEscape(name))
+	}
+	for _, ev := range events {
+		uid := icsUID(ev)
+		if ev.Task {
+			icsLine(w, "BEGIN:VTODO")
+			icsLine(w, "UID:"+icsEscape(uid))
+			icsLine(w, icsDate("DTSTAMP", now, false))
+			icsLine(w, icsDate("DUE", ev.Start, true))
+			icsLine(w, "SUMMARY:"+icsEscape(summary(ev)))
+			if ev.Description != "" {
+				icsLine(w, "DESCRIPTION:"+icsEscape(ev.Description))
+			}
+			icsLine(w, "END:VTODO")
+			continue
+		}
+		icsLine(w, "BEGIN:VEVENT")
+		icsLine(w, "UID:"+icsEscape(uid))
+		if ev.RecurringEventId != "" && ev.OriginalStartTime != nil {
+			if t, allday, err := parseEventTime(ev.OriginalStartTime); err == nil {
+				icsLine(w, icsDate("RECURRENCE-ID", t, allday))
+			}
+		}
+		icsLine(w, icsDate("DTSTAMP", now, false))
+		icsLine(w, icsDate("DTSTART", ev.Start, ev.AllDay))
+		icsLine(w, icsDate("DTEND", ev.End, ev.AllDay))
+		icsLine(w, "SUMMARY:"+icsEscape(summary(ev)))
+		if ev.Location != "" {
+			icsLine(w, "LOCATION:"+icsEscape(ev.Location))
+		}
+		if ev.Description != "" {
+			icsLine(w, "DESCRIPTION:"+icsEscape(ev.Description))
+		}
+		if ev.HtmlLink != "" {
+			icsLine(w, "URL:"+ev.HtmlLink)
+		}
+		for _, a := range ev.Attachments {
+			params := ""
+			if a.MimeType != "" {
+				params += ";FMTTYPE=" + a.MimeType
+			}
+			if a.Title != "" {
+				params += `;FILENAME="` + strings.ReplaceAll(a.Title, `"`, "'") + `"`
+			}
+			icsLine(w, "ATTACH"+params+":"+a.FileUrl)
+		}
+		if status := strings.ToUpper(ev.Status); status == "TENTATIVE" || status == "CONFIRMED" || status == "CANCELLED" {
+			icsLine(w, "STATUS:"+status)
+		}
+		if ev.Transparency == "transparent" {
+			icsLine(w, "TRANSP:TRANSPARENT")
+		}
+		if ev.Settings.Category != "" {
+			icsLine(w, "CATEGORIES:"+icsEscape(ev.Settings.Category))
+		}
+		for _, att := range ev.Attendees {
+			if att.Self && att.Email != "" && icsPartstats[att.ResponseStatus] != "" {
+				icsLine(w, "ATTENDEE;PARTSTAT="+icsPartstats[att.ResponseStatus]+":mailto:"+att.Email)
+			}
+		}
+		for _, rem := range eventReminders(ev) {
+			icsLine(w, "BEGIN:VALARM")
+			if rem.Method == "email" {
+				icsLine(w, "ACTION:EMAIL")
+				icsLine(w, "SUMMARY:"+icsEscape(summary(ev)))
+			} else {
+				icsLine(w, "ACTION:DISPLAY")
+			}
+			icsLine(w, "DESCRIPTION:"+icsEscape(summary(ev)))
+			icsLine(w, "TRIGGER:"+icsTrigger(rem.Minutes))
+			icsLine(w, "END:VALARM")
+		}
+		icsLine(w, "END:VEVENT")
+	}
+	icsLine(w, "END:VCALENDAR")
+	return nil
+}
+
+// commonCalendar is the name of the calendar all the events come from,
+// if there is just one.
+func commonCalendar(events []*agendaEvent) string {
+	if len(events) == 0 {
+		return ""
+	}
+	for _, ev := range events[1:] {
+		if ev.Calendar != events[0].Calendar {
+			return ""
+		}
+	}
+	return events[0].Calendar
+}
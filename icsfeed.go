@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+var icsFiles stringList
+
+func init() {
+	flag.Var(&icsFiles, "ics-file", "Read events from a local iCalendar file (may be repeated)")
+}
+
+// icsSource is a read-only iCalendar feed, such as a public holiday
+// calendar or a team calendar published as a URL.
+type icsSource struct {
+	// Name is the calendar name to show; it defaults to the feed's own
+	// X-WR-CALNAME.
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// icsProvider serves iCalendar feeds as calendars, one per feed. The
+// feeds are fetched once, when listing the calendars.
+type icsProvider struct {
+	sources []icsSource
+	client  *http.Client
+	parsed  map[string]*icsCalendar
+}
+
+func newICSProvider(sources []icsSource) *icsProvider {
+	return &icsProvider{
+		sources: sources,
+		client:  httpClient(time.Minute),
+		parsed:  map[string]*icsCalendar{},
+	}
+}
+
+// open returns the contents of a feed, which may also be a local file. webcal:// is just https:// that
+// calendar applications know to subscribe to.
+func (p *icsProvider) open(ctx context.Context, src string) (io.ReadCloser, error) {
+	if strings.HasPrefix(src, "webcal://") {
+		src = "https://" + strings.TrimPrefix(src, "webcal://")
+	}
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		return os.Open(src)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", src, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %w", src, &statusError{resp.StatusCode, resp.Status})
+	}
+	return resp.Body, nil
+}
+
+func (p *icsProvider) Calendars(ctx context.Context) ([]*calendar.CalendarListEntry, error) {
+	localzone, err := localZone()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*calendar.CalendarListEntry, 0, len(p.sources))
+	for _, src := range p.sources {
+		log.Debugf("Fetching iCalendar feed %s", src.URL)
+		r, err := p.open(ctx, src.URL)
+		if err != nil && failFast {
+			return nil, apiError("%w", err)
+		}
+		if err != nil {
+			// One feed being down shouldn't keep us from the others.
+			calendarFailed(src.URL, err)
+			continue
+		}
+		cal, err := parseICS(r, localzone)
+		r.Close()
+		if err != nil {
+			return nil, apiError("unable to parse %s: %v", src.URL, err)
+		}
+		p.parsed[src.URL] = cal
+		name := strings.TrimSpace(src.Name)
+		if name == "" {
+			name = strings.TrimSpace(cal.Name)
+		}
+		if name == "" {
+			name = src.URL
+		}
+		items = append(items, &calendar.CalendarListEntry{
+			Id:          src.URL,
+			Summary:     name,
+			Description: name,
+			AccessRole:  "reader",
+		})
+	}
+	return items, nil
+}
+
+func (p *icsProvider) Events(ctx context.Context, calid string, start, end time.Time) ([]*calendar.Event, error) {
+	cal, ok := p.parsed[calid]
+	if !ok {
+		return nil, apiError("unknown iCalendar feed %s", calid)
+	}
+	localzone, err := localZone()
+	if err != nil {
+		return nil, err
+	}
+	if noExpand {
+		return seriesInWindow(cal.Events, start, end, localzone)
+	}
+	return eventsInWindow(cal.Events, start, end, localzone)
+}
+
+func (p *icsProvider) Event(ctx context.Context, calid, id string) (*calendar.Event, error) {
+	if cal, ok := p.parsed[calid]; ok {
+		for _, ev := range cal.Events {
+			if ev.Id == id {
+				return ev, nil
+			}
+		}
+	}
+	return nil, apiError("no event %s in %s", id, calid)
+}
+
+// eventSpan returns when an event starts and ends. All-day events span
+// whole days in our own timezone.
+func eventSpan(ev *calendar.Event, localzone *time.Location) (time.Time, time.Time, bool, error) {
+	start, allday, err := parseEventTime(ev.Start)
+	if err != nil {
+		return start, start, allday, err
+	}
+	end, _, err := parseEventTime(ev.End)
+	if err != nil {
+		end = start
+	}
+	if allday {
+		start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, localzone)
+		end = time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, localzone)
+	}
+	return start, end, allday, nil
+}
+
+// eventsInWindow does for iCalendar data what the Google API does for us:
+// expand recurring events, apply the overridden instances, drop the
+// cancelled ones, and keep what overlaps [start, end).
+func eventsInWindow(events []*calendar.Event, start, end time.Time, localzone *time.Location) ([]*calendar.Event, error) {
+	overrides := map[string]*calendar.Event{}
+	for _, ev := range events {
+		if ev.RecurringEventId != "" {
+			overrides[ev.Id] = ev
+		}
+	}
+	inWindow := func(ev *calendar.Event) bool {
+		evstart, evend, _, err := eventSpan(ev, localzone)
+		if err != nil {
+			return false
+		}
+		if !evend.After(evstart) {
+			evend = evstart.Add(time.Second)
+		}
+		return ev.Status != "cancelled" && evstart.Before(end) && evend.After(start)
+	}
+
+	result := make([]*calendar.Event, 0)
+	for _, ev := range events {
+		if ev.RecurringEventId != "" {
+			continue
+		}
+		if len(ev.Recurrence) == 0 {
+			if inWindow(ev) {
+				result = append(result, ev)
+			}
+			continue
+		}
+		instances, err := expandRecurrence(ev, end, localzone)
+		if err != nil {
+			err = fmt.Errorf("event %s: %w", ev.Id, err)
+			if strict {
+				return nil, err
+			}
+			log.Warningf("skipping %v", err)
+			continue
+		}
+		for _, inst := range instances {
+			if o, ok := overrides[inst.Id]; ok {
+				inst = o
+				delete(overrides, inst.Id)
+			}
+			if inWindow(inst) {
+				result = append(result, inst)
+			}
+		}
+	}
+	// Overrides whose original time was outside the window may have
+	// been moved into it.
+	for _, ev := range overrides {
+		if inWindow(ev) {
+			result = append(result, ev)
+		}
+	}
+	sortEvents(result)
+	return result, nil
+}
+
+// seriesInWindow is eventsInWindow for -no-expand: it keeps recurring
+// events whole if they have instances in the window, along with all
+// their overridden instances, cancelled or not, which tell which
+// instances to skip.
+func seriesInWindow(events []*calendar.Event, start, end time.Time, localzone *time.Location) ([]*calendar.Event, error) {
+	kept := map[string]bool{}
+	result := make([]*calendar.Event, 0)
+	for _, ev := range events {
+		if ev.RecurringEventId != "" || len(ev.Recurrence) == 0 {
+			continue
+		}
+		instances, err := expandRecurrence(ev, end, localzone)
+		if err != nil {
+			err = fmt.Errorf("event %s: %w", ev.Id, err)
+			if strict {
+				return nil, err
+			}
+			log.Warningf("skipping %v", err)
+			continue
+		}
+		for _, inst := range instances {
+			if _, instend, _, err := eventSpan(inst, localzone); err == nil && instend.After(start) {
+				kept[ev.Id] = true
+				result = append(result, ev)
+				break
+			}
+		}
+	}
+	single := make([]*calendar.Event, 0)
+	for _, ev := range events {
+		switch {
+		case kept[ev.RecurringEventId]:
+			result = append(result, ev)
+		case len(ev.Recurrence) == 0:
+			single = append(single, ev)
+		}
+	}
+	// The rest is as when expanding.
+	single, err := eventsInWindow(single, start, end, localzone)
+	if err != nil {
+		return nil, err
+	}
+	result = append(result, single...)
+	sortEvents(result)
+	return result, nil
+}
+
+// stringList is a flag that may be given several times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventsInWindow(t *testing.T) {
+	localzone := testNow(t).Location()
+	cal, err := parseICS(strings.NewReader(testICS), localzone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2025, 3, 3, 0, 0, 0, 0, localzone)
+	end := time.Date(2025, 3, 24, 0, 0, 0, 0, localzone)
+	events, err := eventsInWindow(cal.Events, start, end, localzone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// March 10 is an EXDATE, and March 17 was moved to the 18th.
+	want := []string{
+		"weekly@example.com_20250303T150000Z Planning; weekly",
+		"holiday@example.com Holiday",
+		"weekly@example.com_20250317T140000Z Planning (moved)",
+	}
+	got := make([]string, 0, len(events))
+	for _, ev := range events {
+		got = append(got, ev.Id+" "+ev.Summary)
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got events\n\t%s\nwant\n\t%s", strings.Join(got, "\n\t"), strings.Join(want, "\n\t"))
+	}
+
+	// A moved instance shows where it went, even from outside the window.
+	events, err = eventsInWindow(cal.Events, time.Date(2025, 3, 18, 0, 0, 0, 0, localzone), end, localzone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Summary != "Planning (moved)" {
+		t.Errorf("got %d events, want the moved instance alone", len(events))
+	}
+}
+
+func TestEventsInWindowCancelled(t *testing.T) {
+	localzone := testNow(t).Location()
+	const ics = "BEGIN:VCALENDAR\n" +
+		"BEGIN:VEVENT\nUID:daily\nDTSTART;TZID=America/Montreal:20250303T090000\nDTEND;TZID=America/Montreal:20250303T091500\n" +
+		"RRULE:FREQ=DAILY;COUNT=3\nSUMMARY:Sync\nEND:VEVENT\n" +
+		"BEGIN:VEVENT\nUID:daily\nRECURRENCE-ID;TZID=America/Montreal:20250304T090000\n" +
+		"DTSTART;TZID=America/Montreal:20250304T090000\nDTEND;TZID=America/Montreal:20250304T091500\n" +
+		"STATUS:CANCELLED\nSUMMARY:Sync\nEND:VEVENT\n" +
+		"END:VCALENDAR\n"
+	cal, err := parseICS(strings.NewReader(ics), localzone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := eventsInWindow(cal.Events, time.Date(2025, 3, 1, 0, 0, 0, 0, localzone),
+		time.Date(2025, 4, 1, 0, 0, 0, 0, localzone), localzone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := instanceStarts(events); got != "2025-03-03T09:00:00-05:00 2025-03-05T09:00:00-05:00" {
+		t.Errorf("got instances %s, want March 3 and 5", got)
+	}
+}
+
+func TestICSFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "team.ics")
+	if err := os.WriteFile(path, []byte(testICS), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, tt := range []struct{ name, want string }{
+		{"", "Team, East"},
+		{"Work", "Work"},
+	} {
+		p := newICSProvider([]icsSource{{Name: tt.name, URL: path}})
+		list, err := p.Calendars(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 1 || list[0].Id != path || list[0].Summary != tt.want {
+			t.Fatalf("got calendars %+v, want %q", list, tt.want)
+		}
+		events, err := p.Events(ctx, path, time.Date(2025, 3, 3, 0, 0, 0, 0, testNow(t).Location()),
+			time.Date(2025, 3, 10, 0, 0, 0, 0, testNow(t).Location()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 || events[0].Summary != "Planning; weekly" {
+			t.Errorf("got %d events, want the first Planning", len(events))
+		}
+	}
+}
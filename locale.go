@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+var localeName string
+
+func init() {
+	flag.StringVar(&localeName, "locale", "", "Language of day and month names in agenda, markdown and html output, such as de_DE (default: $LC_ALL, $LC_TIME or $LANG)")
+}
+
+// dateNames are a language's names for days and months, in the format
+// (not stand-alone) forms of CLDR's gregorian calendar.
+type dateNames struct {
+	days, shortDays     [7]string
+	months, shortMonths [12]string
+}
+
+var locales = map[string]*dateNames{
+	"da": {
+		days:        [7]string{"søndag", "mandag", "tirsdag", "onsdag", "torsdag", "fredag", "lørdag"},
+		shortDays:   [7]string{"søn.", "man.", "tirs.", "ons.", "tors.", "fre.", "lør."},
+		months:      [12]string{"januar", "februar", "marts", "april", "maj", "juni", "juli", "august", "september", "oktober", "november", "december"},
+		shortMonths: [12]string{"jan.", "feb.", "mar.", "apr.", "maj", "jun.", "jul.", "aug.", "sep.", "okt.", "nov.", "dec."},
+	},
+	"de": {
+		days:        [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		shortDays:   [7]string{"So.", "Mo.", "Di.", "Mi.", "Do.", "Fr.", "Sa."},
+		months:      [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		shortMonths: [12]string{"Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli", "Aug.", "Sept.", "Okt.", "Nov.", "Dez."},
+	},
+	"es": {
+		days:        [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		shortDays:   [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+		months:      [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		shortMonths: [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+	},
+	"fr": {
+		days:        [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		shortDays:   [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+		months:      [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		shortMonths: [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+	},
+	"it": {
+		days:        [7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+		shortDays:   [7]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+		months:      [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		shortMonths: [12]string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+	},
+	"nb": {
+		days:        [7]string{"søndag", "mandag", "tirsdag", "onsdag", "torsdag", "fredag", "lørdag"},
+		shortDays:   [7]string{"søn.", "man.", "tir.", "ons.", "tor.", "fre.", "lør."},
+		months:      [12]string{"januar", "februar", "mars", "april", "mai", "juni", "juli", "august", "september", "oktober", "november", "desember"},
+		shortMonths: [12]string{"jan.", "feb.", "mar.", "apr.", "mai", "jun.", "jul.", "aug.", "sep.", "okt.", "nov.", "des."},
+	},
+	"nl": {
+		days:        [7]string{"zondag", "maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag"},
+		shortDays:   [7]string{"zo", "ma", "di", "wo", "do", "vr", "za"},
+		months:      [12]string{"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"},
+		shortMonths: [12]string{"jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+	},
+	"pt": {
+		days:        [7]string{"domingo", "segunda-feira", "terça-feira", "quarta-feira", "quinta-feira", "sexta-feira", "sábado"},
+		shortDays:   [7]string{"dom.", "seg.", "ter.", "qua.", "qui.", "sex.", "sáb."},
+		months:      [12]string{"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"},
+		shortMonths: [12]string{"jan.", "fev.", "mar.", "abr.", "mai.", "jun.", "jul.", "ago.", "set.", "out.", "nov.", "dez."},
+	},
+	"sv": {
+		days:        [7]string{"söndag", "måndag", "tisdag", "onsdag", "torsdag", "fredag", "lördag"},
+		shortDays:   [7]string{"sön", "mån", "tis", "ons", "tors", "fre", "lör"},
+		months:      [12]string{"januari", "februari", "mars", "april", "maj", "juni", "juli", "augusti", "september", "oktober", "november", "december"},
+		shortMonths: [12]string{"jan.", "feb.", "mars", "apr.", "maj", "juni", "juli", "aug.", "sep.", "okt.", "nov.", "dec."},
+	},
+}
+
+// names is the selected language's, or nil for English.
+var names *dateNames
+
+// localeLanguage turns a POSIX locale such as de_DE.UTF-8 into its
+// language, de.
+func localeLanguage(locale string) string {
+	lang, _, _ := strings.Cut(locale, ".")
+	lang, _, _ = strings.Cut(lang, "@")
+	lang, _, _ = strings.Cut(lang, "_")
+	lang, _, _ = strings.Cut(lang, "-")
+	lang = strings.ToLower(lang)
+	if lang == "no" || lang == "nn" {
+		// We only have Bokmål.
+		lang = "nb"
+	}
+	return lang
+}
+
+// loadLocale selects the language of dates from -locale or, failing
+// that, the environment as POSIX has it. A -locale we don't know is an
+// error; an environment we don't know is English.
+func loadLocale() error {
+	locale := localeName
+	if locale == "" {
+		for _, env := range []string{"LC_ALL", "LC_TIME", "LANG"} {
+			if locale = os.Getenv(env); locale != "" {
+				break
+			}
+		}
+	}
+	lang := localeLanguage(locale)
+	switch lang {
+	case "", "c", "posix", "en":
+		return nil
+	}
+	names = locales[lang]
+	if names == nil && localeName != "" {
+		known := []string{"en"}
+		for l := range locales {
+			known = append(known, l)
+		}
+		sort.Strings(known)
+		return usageError("unsupported locale %s (languages: %s)", localeName, strings.Join(known, ", "))
+	}
+	if names == nil {
+		log.Debugf("No date names for locale %s, using English", locale)
+	}
+	return nil
+}
+
+// The layout elements localDate translates, longest first so that Mon
+// isn't found in Monday.
+var nameElements = []string{"Monday", "January", "Mon", "Jan"}
+
+// localDate is t.Format(layout) with day and month names in the
+// selected language, for the output meant for people.
+func localDate(t time.Time, layout string) string {
+	if names == nil {
+		return t.Format(layout)
+	}
+	// Format the other elements of the layout around placeholders that
+	// time.Format leaves alone, then put the names in.
+	placeholders := make([]string, 0, 2*len(nameElements))
+	for i, elem := range nameElements {
+		placeholders = append(placeholders, elem, string(rune(0xE000+i)))
+	}
+	formatted := t.Format(strings.NewReplacer(placeholders...).Replace(layout))
+	return strings.NewReplacer(
+		string(rune(0xE000)), names.days[t.Weekday()],
+		string(rune(0xE001)), names.months[t.Month()-1],
+		string(rune(0xE002)), names.shortDays[t.Weekday()],
+		string(rune(0xE003)), names.shortMonths[t.Month()-1],
+	).Replace(formatted)
+}
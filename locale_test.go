@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocaleLanguage(t *testing.T) {
+	tests := map[string]string{
+		"de_DE.UTF-8":     "de",
+		"sr_RS@latin":     "sr",
+		"pt-BR":           "pt",
+		"FR":              "fr",
+		"no_NO.ISO8859-1": "nb",
+		"nn_NO":           "nb",
+		"C":               "c",
+		"":                "",
+	}
+	for locale, want := range tests {
+		if got := localeLanguage(locale); got != want {
+			t.Errorf("localeLanguage(%q) = %q, want %q", locale, got, want)
+		}
+	}
+}
+
+// withLocale selects the date names as loadLocale does for -locale
+// and the environment given, and puts back English when the test is
+// done.
+func withLocale(t *testing.T, flagValue, lang string) error {
+	t.Helper()
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_TIME", "")
+	t.Setenv("LANG", lang)
+	old := localeName
+	t.Cleanup(func() { localeName, names = old, nil })
+	localeName, names = flagValue, nil
+	return loadLocale()
+}
+
+func TestLocalDate(t *testing.T) {
+	wed := time.Date(2025, 3, 5, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		flagValue, lang string
+		layout, want    string
+	}{
+		{"", "", "Mon Jan 02", "Wed Mar 05"},
+		{"", "en_CA.UTF-8", "Monday 2 January 2006", "Wednesday 5 March 2025"},
+		{"fr_FR", "", "Mon Jan 02", "mer. mars 05"},
+		{"", "fr_CA.UTF-8", "Monday 2 January, 15:04", "mercredi 5 mars, 10:30"},
+		{"de", "fr_FR", "Mon, 02. Jan", "Mi., 05. März"},
+		// We have no Japanese, so that is English.
+		{"", "ja_JP.UTF-8", "Mon Jan 02", "Wed Mar 05"},
+	}
+	for _, tt := range tests {
+		if err := withLocale(t, tt.flagValue, tt.lang); err != nil {
+			t.Errorf("-locale %q, LANG=%q: %v", tt.flagValue, tt.lang, err)
+			continue
+		}
+		if got := localDate(wed, tt.layout); got != tt.want {
+			t.Errorf("-locale %q, LANG=%q: got %q, want %q", tt.flagValue, tt.lang, got, tt.want)
+		}
+	}
+}
+
+func TestLoadLocaleUnknown(t *testing.T) {
+	if err := withLocale(t, "ja_JP", ""); err == nil {
+		t.Error("got no error for -locale ja_JP")
+	}
+}
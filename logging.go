@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/op/go-logging"
+)
+
+var (
+	quiet     bool
+	verbose   bool
+	vverbose  bool
+	logformat string
+)
+
+func init() {
+	flag.BoolVar(&quiet, "quiet", false, "Suppress all logging, leaving only the formatted output")
+	flag.BoolVar(&verbose, "v", false, "Verbose logging, with debug output (same as -debug)")
+	flag.BoolVar(&vverbose, "vv", false, "Very verbose logging: -v, and every HTTP request made")
+	flag.StringVar(&logformat, "log-format", "text", "Log format (text|json)")
+}
+
+// jsonFormatter writes each log record as a single JSON object, for
+// log collectors that would rather not parse our text format.
+type jsonFormatter struct{}
+
+func (jsonFormatter) Format(calldepth int, r *logging.Record, w io.Writer) error {
+	rec := struct {
+		Time    string `json:"time"`
+		Level   string `json:"level"`
+		Module  string `json:"module"`
+		File    string `json:"file,omitempty"`
+		Line    int    `json:"line,omitempty"`
+		Message string `json:"message"`
+	}{
+		Time:    r.Time.Format("2006-01-02T15:04:05.000Z07:00"),
+		Level:   r.Level.String(),
+		Module:  r.Module,
+		Message: r.Message(),
+	}
+	if _, file, line, ok := runtime.Caller(calldepth + 1); ok {
+		rec.File = filepath.Base(file)
+		rec.Line = line
+	}
+	return json.NewEncoder(w).Encode(rec)
+}
+
+// setupLogging configures the logger from the command line flags. All
+// diagnostics go to stderr so they never end up mixed with the output.
+func setupLogging() error {
+	var format logging.Formatter
+	switch logformat {
+	case "text":
+		format = logging.MustStringFormatter(
+			`%{time:2006-01-02 15:04:05.000-0700} %{level} [%{shortfile}] %{message}`,
+		)
+	case "json":
+		format = jsonFormatter{}
+	default:
+		return usageError("unsupported log format: %s", logformat)
+	}
+	stderrBackend := logging.NewLogBackend(os.Stderr, "", 0)
+	stderrFormatter := logging.NewBackendFormatter(stderrBackend, format)
+	stderrBackendLevelled := logging.AddModuleLevel(stderrFormatter)
+	logging.SetBackend(stderrBackendLevelled)
+	switch {
+	case quiet:
+		stderrBackendLevelled.SetLevel(logging.CRITICAL, "gcal")
+	case debug || verbose || vverbose:
+		stderrBackendLevelled.SetLevel(logging.DEBUG, "gcal")
+	default:
+		stderrBackendLevelled.SetLevel(logging.INFO, "gcal")
+	}
+	return nil
+}
@@ -8,14 +8,13 @@ import (
 	"fmt"
 	"net/http"
 	"os"
-	"strings"
-	"time"
 
 	"github.com/op/go-logging"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/calendar/v3"
 	"google.golang.org/api/option"
+	"google.golang.org/api/tasks/v1"
 )
 
 var (
@@ -23,222 +22,246 @@ var (
 	debug    bool            = false
 	duration string
 	format   string
+	orgStyle string
 	emptycal bool
+	strict   bool
+	calnames string
 )
 
+// Process exit codes, so that cron wrappers and status scripts can tell
+// what happened without parsing our logs.
+const (
+	exitOK       = 0 // events found
+	exitUsage    = 1 // bad flags or arguments
+	exitAuth     = 2 // credentials or token problems
+	exitAPI      = 3 // the calendar API failed
+	exitNoEvents = 4 // nothing in the requested window
+)
+
+// exitError is an error carrying the exit code main should use for it.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+var errNoEvents = &exitError{exitNoEvents, errors.New("no events in window")}
+
+func usageError(format string, args ...interface{}) error {
+	return &exitError{exitUsage, fmt.Errorf(format, args...)}
+}
+
+func authError(format string, args ...interface{}) error {
+	return &exitError{exitAuth, fmt.Errorf(format, args...)}
+}
+
+func apiError(format string, args ...interface{}) error {
+	return &exitError{exitAPI, fmt.Errorf(format, args...)}
+}
+
+// exitCode maps an error returned by run to a process exit code.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var ee *exitError
+	if errors.As(err, &ee) {
+		return ee.code
+	}
+	return exitAPI
+}
+
 func init() {
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	flag.Usage = usage
 	flag.BoolVar(&debug, "debug", false, "Debug logging")
 	flag.BoolVar(&emptycal, "emptycal", false, "Include empty calendar names (false)")
-	flag.StringVar(&duration, "duration", "1d", "Duration from now to check (1d|1w|1m)")
-	flag.StringVar(&format, "format", "", "output format (remind|org)")
-	flag.Parse()
-
-	if format == "" {
-		flag.PrintDefaults()
-		os.Exit(1)
-	}
-
-	format := logging.MustStringFormatter(
-		`%{time:2006-01-02 15:04:05.000-0700} %{level} [%{shortfile}] %{message}`,
-	)
-	stderrBackend := logging.NewLogBackend(os.Stderr, "", 0)
-	stderrFormatter := logging.NewBackendFormatter(stderrBackend, format)
-	stderrBackendLevelled := logging.AddModuleLevel(stderrFormatter)
-	logging.SetBackend(stderrBackendLevelled)
-	if debug {
-		stderrBackendLevelled.SetLevel(logging.DEBUG, "gcal")
-	} else {
-		stderrBackendLevelled.SetLevel(logging.INFO, "gcal")
-	}
+	flag.StringVar(&duration, "duration", "1d", "Duration from now to check (1d|1w|1m, or any number of d, w, m or y)")
+	flag.StringVar(&format, "format", "", "output format (agenda|html|ics|json|markdown|remind|org|table|taskwarrior)")
+	flag.StringVar(&orgStyle, "org-style", "flat", "Layout of the org format (flat|weektree)")
+	flag.StringVar(&calnames, "calendar", "", "Only query these calendars (comma separated ids or names)")
+	flag.BoolVar(&strict, "strict", false, "Fail on the first malformed event instead of skipping it")
 	log = logging.MustGetLogger("gcal")
 }
 
-// Retrieve a token, saves the token, then returns the generated client.
-func getClient(config *oauth2.Config) *http.Client {
-	// The file token.json stores the user's access and refresh tokens, and is
+// getClient returns a client for the token saved in tokFile. authorize
+// runs the provider's flow for getting a token when we don't have one
+// yet, and the token it gets is saved.
+func getClient(config *oauth2.Config, tokFile string,
+	authorize func(*oauth2.Config) (*oauth2.Token, error)) (*http.Client, error) {
+	// The token file stores the user's access and refresh tokens, and is
 	// created automatically when the authorization flow completes for the first
 	// time.
-	tokFile := "token.json"
 	tok, err := tokenFromFile(tokFile)
-	if err != nil {
-		tok = getTokenFromWeb(config)
-		saveToken(tokFile, tok)
+	var ee *exitError
+	if errors.As(err, &ee) {
+		// The file is there but we can't decrypt it.
+		return nil, err
+	}
+	if err == nil && encryptToken && !tokenEncrypted && !forceAuth {
+		// Encrypt a plain token file the first time we're asked to.
+		if err := saveToken(tokFile, tok); err != nil {
+			return nil, err
+		}
 	}
-	return config.Client(context.Background(), tok)
+	if err != nil || forceAuth {
+		tok, err = authorize(config)
+		if err != nil {
+			return nil, err
+		}
+		if err := saveToken(tokFile, tok); err != nil {
+			return nil, err
+		}
+	}
+	// Refresh the access token a little ahead of its expiry, and save
+	// the new one so that the next run doesn't have to refresh again.
+	ctx := oauthContext()
+	tokens = oauth2.ReuseTokenSourceWithExpiry(tok, &tokenRefresher{ctx, config, tok, tokFile}, tokenEarlyExpiry)
+	return oauth2.NewClient(ctx, tokens), nil
 }
 
 // Request a token from the web, then returns the retrieved token.
-func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
+func getTokenFromWeb(config *oauth2.Config) (*oauth2.Token, error) {
 	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	log.Infof("Go to the following link in your browser then type the "+
+	// This is a prompt rather than a diagnostic, so it must be seen even
+	// with --quiet, and must stay off stdout.
+	fmt.Fprintf(os.Stderr, "Go to the following link in your browser then type the "+
 		"authorization code: \n%v\n", authURL)
 
 	var authCode string
 	if _, err := fmt.Scan(&authCode); err != nil {
-		log.Fatalf("Unable to read authorization code: %v", err)
+		return nil, authError("unable to read authorization code: %v", err)
 	}
 
-	tok, err := config.Exchange(context.TODO(), authCode)
+	tok, err := config.Exchange(oauthContext(), authCode)
 	if err != nil {
-		log.Fatalf("Unable to retrieve token from web: %v", err)
+		return nil, authError("unable to retrieve token from web: %v", err)
 	}
-	return tok
+	return tok, nil
 }
 
 // Retrieves a token from a local file.
 func tokenFromFile(file string) (*oauth2.Token, error) {
-	f, err := os.Open(file)
+	b, err := os.ReadFile(file)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	if b, err = openToken(b); err != nil {
+		return nil, err
+	}
 	tok := &oauth2.Token{}
-	err = json.NewDecoder(f).Decode(tok)
+	err = json.Unmarshal(b, tok)
 	return tok, err
 }
 
 // Saves a token to a file path.
-func saveToken(path string, token *oauth2.Token) {
+func saveToken(path string, token *oauth2.Token) error {
+	return mutate("save the oauth token to "+path, func() error {
+		return writeToken(path, token)
+	})
+}
+
+// writeToken is saveToken even with -dry-run, for refreshed tokens: a
+// refresh can replace the refresh token, and a dry run must not cost us
+// the authorization.
+func writeToken(path string, token *oauth2.Token) error {
 	log.Debugf("Saving credential file to: %s\n", path)
-	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-	if err != nil {
-		log.Fatalf("Unable to cache oauth token: %v", err)
-	}
-	defer f.Close()
-	json.NewEncoder(f).Encode(token)
-}
-
-func getEvents(srv *calendar.Service, calid, caldesc string) ([]*calendar.Event, error) {
-	events2return := make([]*calendar.Event, 0)
-	now := time.Now().Local()
-	midnight_today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local).
-		Format(time.RFC3339)
-	midnight_tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.Local).
-		Format(time.RFC3339)
-	midnight_oneweek := time.Date(now.Year(), now.Month(), now.Day()+7, 0, 0, 0, 0, time.Local).
-		Format(time.RFC3339)
-	midnight_onemonth := time.Date(now.Year(), now.Month()+1, now.Day(), 0, 0, 0, 0, time.Local).
-		Format(time.RFC3339)
-
-	endtime := midnight_tomorrow
-	if duration == "1w" {
-		endtime = midnight_oneweek
-	} else if duration == "1m" {
-		endtime = midnight_onemonth
-	} else if duration != "1d" {
-		log.Errorf("Invalid duration: %s", duration)
-		return events2return, errors.New("Invalid duration")
-	}
-
-	log.Debugf("Querying calendar %s for events from %s to %s\n", calid, midnight_today, midnight_tomorrow)
-	events, err := srv.Events.List(calid).ShowDeleted(false).
-		SingleEvents(true).TimeMin(midnight_today).TimeMax(endtime).OrderBy("startTime").Do()
+	b, err := json.Marshal(token)
 	if err != nil {
-		log.Fatalf("Unable to retrieve today's events from calendar %s: %v", calid, err)
-		return events2return, err
+		return authError("unable to cache oauth token: %v", err)
 	}
-	if caldesc == "" {
-		log.Debug("calendar description is empty, using calendar id")
-		caldesc = calid
+	b = append(b, '\n')
+	if encryptToken || tokenEncrypted {
+		if b, err = sealToken(b); err != nil {
+			return err
+		}
 	}
-	log.Debugf("Upcoming events from calendar, duration %s, \"%s\":", duration, caldesc)
-	if len(events.Items) == 0 {
-		log.Debug("No upcoming events found.")
-	} else {
-		log.Debugf("Found %d events", len(events.Items))
-		events2return = events.Items
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		return authError("unable to cache oauth token: %v", err)
 	}
-	return events2return, nil
+	return nil
 }
 
-func getCalendarList(srv *calendar.Service) (*calendar.CalendarList, error) {
-	calendar_list, err := srv.CalendarList.List().Do()
-	if err != nil {
-		return nil, err
+func main() {
+	err := run()
+	if err == nil || err == errNoEvents {
+		// The calendars that failed to read still make the run a failure.
+		if failed := calendarFailures(); failed != nil {
+			err = failed
+		}
 	}
-	return calendar_list, nil
+	if err != nil && err != errNoEvents {
+		log.Errorf("%s", err)
+	}
+	os.Exit(exitCode(err))
 }
 
-func main() {
-	ctx := context.Background()
-	b, err := os.ReadFile("credentials.json")
+// scopes are the OAuth scopes gcal asks for.
+var scopes = []string{
+	calendar.CalendarReadonlyScope,
+	tasks.TasksReadonlyScope,
+}
+
+// googleClient authorizes against Google and returns an HTTP client for
+// the APIs.
+func googleClient() (*http.Client, error) {
+	b, err := os.ReadFile(prof.Credentials)
 	if err != nil {
-		log.Fatalf("Unable to read client secret file: %v", err)
+		return nil, authError("unable to read client secret file: %v", err)
 	}
 
 	// If modifying these scopes, delete your previously saved token.json.
-	config, err := google.ConfigFromJSON(b, calendar.CalendarReadonlyScope)
+	config, err := google.ConfigFromJSON(b, scopes...)
 	if err != nil {
-		log.Fatalf("Unable to parse client secret file to config: %v", err)
+		return nil, authError("unable to parse client secret file to config: %v", err)
 	}
-	client := getClient(config)
+	return getClient(config, prof.Token, getTokenFromWeb)
+}
 
-	srv, err := calendar.NewService(ctx, option.WithHTTPClient(client))
+// calendarService returns a Calendar API client.
+func calendarService(ctx context.Context) (*calendar.Service, error) {
+	client, err := googleClient()
 	if err != nil {
-		log.Fatalf("Unable to retrieve Calendar client: %v", err)
+		return nil, err
 	}
-
-	calendar_list, err := getCalendarList(srv)
+	srv, err := calendar.NewService(ctx, option.WithHTTPClient(client))
 	if err != nil {
-		panic(err)
+		return nil, apiError("unable to retrieve Calendar client: %v", err)
 	}
-	if format == "org" {
-		fmt.Println("# -*- mode: org -*-")
+	return srv, nil
+}
+
+func run() error {
+	if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return &exitError{exitUsage, err}
 	}
-	// Our local timezone
-	localzone, err := time.LoadLocation("America/Montreal")
-	if err != nil {
-		panic(err)
+	if err := setupLogging(); err != nil {
+		return err
 	}
-	for _, item := range calendar_list.Items {
-		events, err := getEvents(srv, item.Id, item.Description)
-		calname := strings.TrimSpace(item.Description)
-		if calname == "" && !emptycal {
-			continue
-		}
-		if err != nil {
-			log.Errorf("%s", err)
-			os.Exit(1)
-		}
-		for _, item := range events {
-			var err error
-			date := item.Start.DateTime
-			if err != nil {
-				panic(err)
-			}
-			var start time.Time
-			if date == "" {
-				// 2025-01-05
-				date = item.Start.Date
-				start, err = time.Parse("2006-01-02", date)
-				if err != nil {
-					panic(err)
-				}
-			} else {
-				// 2025-01-05T10:00:00-05:00
-				start, err = time.Parse(time.RFC3339, date)
-				if err != nil {
-					panic(err)
-				}
-			}
-			// Convert to localtime.
-			local_start := start.In(localzone)
-			summary := strings.TrimSpace(item.Summary)
-			if format == "remind" {
-				fmt.Printf("REM %s AT %02d:%02d MSG %%\"%s%%\" %%b, %%2\n",
-					local_start.Format("Jan 02"), local_start.Hour(), local_start.Minute(), summary)
-			} else if format == "org" {
-				_, week := local_start.ISOWeek()
-				fmt.Printf("* %s <%s>\n", summary, local_start.Format("2006-01-02 Mon 15:04:05"))
-				fmt.Printf("  #+PROPERTY: week=%d\n", week)
-				// Add a property with the calendar name
-				if calname != "" {
-					fmt.Printf("  #+PROPERTY: calendar=%s\n", calname)
-				}
-			} else {
-				panic("unsupported format")
-			}
+	if err := loadConfig(); err != nil {
+		if cmd, ok := commands[flag.Arg(0)]; !ok || !cmd.anyConfig {
+			return err
 		}
 	}
-	os.Exit(0)
+	if showVersion {
+		printVersion()
+		return nil
+	}
+	// Commands take flags of their own, so they set up the transport
+	// and locale once they have them.
+	if flag.NArg() > 0 {
+		return runCommand(flag.Args())
+	}
+	if err := setupTransport(); err != nil {
+		return err
+	}
+	if err := loadLocale(); err != nil {
+		return err
+	}
+	return runAgenda(context.Background())
 }
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Log as gcal does by default, rather than everything.
+	if err := setupLogging(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// testNow is Wednesday, March 5 2025, the week before Montreal moves
+// its clocks forward.
+func testNow(t *testing.T) time.Time {
+	t.Helper()
+	loc, err := time.LoadLocation("America/Montreal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return time.Date(2025, 3, 5, 10, 30, 0, 0, loc)
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+var (
+	mcpWrite     bool
+	mcpAuthorize bool
+)
+
+func init() {
+	register(&command{
+		name:    "mcp",
+		summary: "Serve calendar tools to AI assistants over the Model Context Protocol on stdio",
+		flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&mcpWrite, "write", false, "Also offer a tool to create events (needs a token with write access)")
+			fs.BoolVar(&mcpAuthorize, "authorize", false, "Get a new token with the access the server needs, then exit")
+		},
+		run: runMCP,
+	})
+}
+
+// mcpProtocolVersion is the MCP revision we implement.
+const mcpProtocolVersion = "2024-11-05"
+
+// JSON-RPC 2.0 messages, one per line.
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// JSON-RPC error codes.
+const (
+	rpcParseError     = -32700
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+type mcpTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+	call        func(ctx context.Context, args json.RawMessage) (string, error)
+}
+
+type mcpServer struct {
+	cache *eventCache
+	tools []*mcpTool
+}
+
+func newMCPServer() *mcpServer {
+	s := &mcpServer{cache: &eventCache{ttl: time.Minute, entries: map[string]*cacheEntry{}}}
+	s.tools = []*mcpTool{{
+		Name:        "list_calendars",
+		Description: "List the user's calendars.",
+		InputSchema: json.RawMessage(`{"type": "object", "properties": {}}`),
+		call:        s.listCalendars,
+	}, {
+		Name:        "list_events",
+		Description: "List the user's events from today until the end of the window.",
+		InputSchema: json.RawMessage(`{"type": "object", "properties": {
+			"duration": {"type": "string", "description": "How far ahead to look: a number of days, weeks, months or years such as 1d, 2w, 1m or 1y, or a stretch of calendar such as today, tomorrow, next week or rest of month"},
+			"calendar": {"type": "string", "description": "Only events of the calendar with this name or id"}
+		}}`),
+		call: s.listEvents,
+	}, {
+		Name:        "freebusy",
+		Description: "List the times the user is busy, from today until the end of the window.",
+		InputSchema: json.RawMessage(`{"type": "object", "properties": {
+			"duration": {"type": "string", "description": "How far ahead to look: a number of days, weeks, months or years such as 1d, 2w, 1m or 1y, or a stretch of calendar such as today, tomorrow, next week or rest of month"}
+		}}`),
+		call: s.freeBusy,
+	}}
+	if mcpWrite {
+		s.tools = append(s.tools, &mcpTool{
+			Name:        "create_event",
+			Description: "Create an event in one of the user's Google calendars.",
+			InputSchema: json.RawMessage(`{"type": "object", "properties": {
+				"summary": {"type": "string"},
+				"start": {"type": "string", "description": "RFC 3339 start time"},
+				"end": {"type": "string", "description": "RFC 3339 end time"},
+				"description": {"type": "string"},
+				"location": {"type": "string"},
+				"calendar": {"type": "string", "description": "Calendar id, primary by default"}
+			}, "required": ["summary", "start", "end"]}`),
+			call: s.createEvent,
+		})
+	}
+	return s
+}
+
+type durationArgs struct {
+	Duration string `json:"duration"`
+	Calendar string `json:"calendar"`
+}
+
+func (s *mcpServer) events(ctx context.Context, raw json.RawMessage) ([]*agendaEvent, *durationArgs, error) {
+	args := &durationArgs{}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, args); err != nil {
+			return nil, nil, err
+		}
+	}
+	if args.Duration == "" {
+		args.Duration = duration
+	}
+	if _, _, err := window(time.Now(), args.Duration); err != nil {
+		return nil, nil, err
+	}
+	events, err := s.cache.get(ctx, args.Duration)
+	return events, args, err
+}
+
+// calendarInfo is what list_calendars tells about a calendar.
+type calendarInfo struct {
+	ID          string `json:"id"`
+	Summary     string `json:"summary"`
+	Description string `json:"description"`
+}
+
+func (s *mcpServer) listCalendars(ctx context.Context, raw json.RawMessage) (string, error) {
+	ps, err := sources(ctx)
+	if err != nil {
+		return "", err
+	}
+	cals := make([]calendarInfo, 0)
+	for _, p := range ps {
+		list, err := p.Calendars(ctx)
+		if err != nil {
+			return "", err
+		}
+		for _, item := range selectCalendars(list) {
+			cals = append(cals, calendarInfo{ID: item.Id, Summary: item.Summary, Description: calendarName(item)})
+		}
+	}
+	return toJSON(cals)
+}
+
+func (s *mcpServer) listEvents(ctx context.Context, raw json.RawMessage) (string, error) {
+	events, args, err := s.events(ctx, raw)
+	if err != nil {
+		return "", err
+	}
+	list := make([]*jsonEvent, 0, len(events))
+	for _, ev := range sortedByStart(events) {
+		if args.Calendar != "" && args.Calendar != ev.CalendarID &&
+			!strings.EqualFold(args.Calendar, ev.Calendar) {
+			continue
+		}
+		list = append(list, newJSONEvent(ev))
+	}
+	return toJSON(list)
+}
+
+func (s *mcpServer) freeBusy(ctx context.Context, raw json.RawMessage) (string, error) {
+	events, _, err := s.events(ctx, raw)
+	if err != nil {
+		return "", err
+	}
+	return toJSON(busyIntervals(events))
+}
+
+type createArgs struct {
+	Summary     string `json:"summary"`
+	Start       string `json:"start"`
+	End         string `json:"end"`
+	Description string `json:"description"`
+	Location    string `json:"location"`
+	Calendar    string `json:"calendar"`
+}
+
+func (s *mcpServer) createEvent(ctx context.Context, raw json.RawMessage) (string, error) {
+	args := &createArgs{}
+	if err := json.Unmarshal(raw, args); err != nil {
+		return "", err
+	}
+	start, err := time.Parse(time.RFC3339, args.Start)
+	if err != nil {
+		return "", fmt.Errorf("bad start: %v", err)
+	}
+	end, err := time.Parse(time.RFC3339, args.End)
+	if err != nil {
+		return "", fmt.Errorf("bad end: %v", err)
+	}
+	if !end.After(start) {
+		return "", fmt.Errorf("the event ends before it starts")
+	}
+	if args.Calendar == "" {
+		args.Calendar = "primary"
+	}
+	ev := &calendar.Event{
+		Summary:     args.Summary,
+		Description: args.Description,
+		Location:    args.Location,
+		Start:       &calendar.EventDateTime{DateTime: start.Format(time.RFC3339)},
+		End:         &calendar.EventDateTime{DateTime: end.Format(time.RFC3339)},
+	}
+	p, err := newGoogleProvider(ctx)
+	if err != nil {
+		return "", err
+	}
+	created, err := p.(writer).Insert(ctx, args.Calendar, ev)
+	if err != nil {
+		return "", err
+	}
+	// Let the next listing see the new event.
+	s.cache.mu.Lock()
+	s.cache.entries = map[string]*cacheEntry{}
+	s.cache.mu.Unlock()
+	return toJSON(map[string]string{"id": created.Id, "link": created.HtmlLink})
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	return string(b), err
+}
+
+type toolCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type toolContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type toolResult struct {
+	Content []toolContent `json:"content"`
+	IsError bool          `json:"isError"`
+}
+
+// handle answers a request. Notifications, which have no id, get no
+// answer.
+func (s *mcpServer) handle(ctx context.Context, req *rpcRequest) *rpcResponse {
+	resp := &rpcResponse{JSONRPC: "2.0", ID: req.ID}
+	switch req.Method {
+	case "initialize":
+		resp.Result = map[string]interface{}{
+			"protocolVersion": mcpProtocolVersion,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]string{"name": "gcal", "version": version},
+		}
+	case "ping":
+		resp.Result = map[string]interface{}{}
+	case "tools/list":
+		resp.Result = map[string]interface{}{"tools": s.tools}
+	case "tools/call":
+		call := &toolCall{}
+		if err := json.Unmarshal(req.Params, call); err != nil {
+			resp.Error = &rpcError{rpcInvalidParams, err.Error()}
+			break
+		}
+		var tool *mcpTool
+		for _, t := range s.tools {
+			if t.Name == call.Name {
+				tool = t
+			}
+		}
+		if tool == nil {
+			resp.Error = &rpcError{rpcInvalidParams, "unknown tool: " + call.Name}
+			break
+		}
+		log.Infof("calling tool %s", call.Name)
+		// Tool failures are for the model to see, not protocol errors.
+		text, err := tool.call(ctx, call.Arguments)
+		if err != nil {
+			log.Warningf("tool %s: %v", call.Name, err)
+			resp.Result = &toolResult{Content: []toolContent{{"text", err.Error()}}, IsError: true}
+		} else {
+			resp.Result = &toolResult{Content: []toolContent{{"text", text}}}
+		}
+	default:
+		if strings.HasPrefix(req.Method, "notifications/") {
+			return nil
+		}
+		resp.Error = &rpcError{rpcMethodNotFound, "unknown method: " + req.Method}
+	}
+	if req.ID == nil {
+		return nil
+	}
+	return resp
+}
+
+// serveMCP answers requests read from r, one JSON message per line,
+// until r ends.
+func (s *mcpServer) serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	enc := json.NewEncoder(w)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		req := &rpcRequest{}
+		var resp *rpcResponse
+		if err := json.Unmarshal(line, req); err != nil {
+			resp = &rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"),
+				Error: &rpcError{rpcParseError, err.Error()}}
+		} else {
+			resp = s.handle(ctx, req)
+		}
+		if resp == nil {
+			continue
+		}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func runMCP(args []string) error {
+	sharedOutput = true
+	if mcpWrite {
+		if prof.Provider != "google" {
+			return usageError("creating events is only available with Google")
+		}
+		scopes = append(scopes, calendar.CalendarEventsScope)
+	}
+	if mcpAuthorize {
+		if prof.Provider != "google" {
+			return usageError("only Google needs authorizing")
+		}
+		_, err := authorize(context.Background(), true)
+		return err
+	}
+	// Stdin is the protocol, so there is no asking for an authorization
+	// code on it.
+	if prof.Provider == "google" {
+		if _, err := os.Stat(prof.Token); err != nil {
+			return authError("no token in %s; run gcal mcp -authorize to get one first", prof.Token)
+		}
+	}
+	if _, err := parseFilters(); err != nil {
+		return err
+	}
+	return newMCPServer().serve(context.Background(), os.Stdin, os.Stdout)
+}
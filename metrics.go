@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// serverMetrics counts how fetching has gone, for /metrics.
+type serverMetrics struct {
+	mu          sync.Mutex
+	fetches     int
+	errors      int
+	lastSuccess time.Time
+}
+
+func (m *serverMetrics) fetched(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fetches++
+	if err != nil {
+		m.errors++
+	} else {
+		m.lastSuccess = time.Now()
+	}
+}
+
+// meetingHoursToday is how many hours of today are taken by meetings.
+func meetingHoursToday(now time.Time, events []*agendaEvent) float64 {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	tomorrow := midnight.AddDate(0, 0, 1)
+	var total time.Duration
+	for _, iv := range busyIntervals(events) {
+		start, end := iv.Start, iv.End
+		if start.Before(midnight) {
+			start = midnight
+		}
+		if end.After(tomorrow) {
+			end = tomorrow
+		}
+		if end.After(start) {
+			total += end.Sub(start)
+		}
+	}
+	return total.Hours()
+}
+
+// upcomingSeconds is how long until the next timed event starts, or NaN
+// if there is none in the window.
+func upcomingSeconds(now time.Time, events []*agendaEvent) float64 {
+	next := math.NaN()
+	for _, ev := range events {
+		if ev.AllDay || ev.Task || !ev.Start.After(now) {
+			continue
+		}
+		if s := ev.Start.Sub(now).Seconds(); math.IsNaN(next) || s < next {
+			next = s
+		}
+	}
+	return next
+}
+
+func writeMetric(w http.ResponseWriter, name, kind, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, kind, name, value)
+}
+
+// handleMetrics answers in the Prometheus text format. The event gauges
+// are left out when the calendars can't be read, and gcal_up says so.
+func (s *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	localzone, err := localZone()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	events, err := s.cache.get(r.Context(), duration)
+	if err != nil {
+		log.Errorf("%s: %v", r.URL, err)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	up := 0.0
+	if err == nil {
+		up = 1
+		now := time.Now().In(localzone)
+		writeMetric(w, "gcal_upcoming_event_seconds", "gauge",
+			"Seconds until the next timed event starts.", upcomingSeconds(now, events))
+		writeMetric(w, "gcal_events_in_window", "gauge",
+			"Number of events in the -duration window.", float64(len(events)))
+		writeMetric(w, "gcal_meeting_hours_today", "gauge",
+			"Hours of today taken by meetings.", meetingHoursToday(now, events))
+	}
+	writeMetric(w, "gcal_up", "gauge", "Whether the calendars could be read.", up)
+
+	m := &s.cache.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	writeMetric(w, "gcal_fetches_total", "counter", "Number of times events were fetched.", float64(m.fetches))
+	writeMetric(w, "gcal_api_errors_total", "counter", "Number of fetches that failed.", float64(m.errors))
+	if !m.lastSuccess.IsZero() {
+		writeMetric(w, "gcal_last_success_timestamp_seconds", "gauge",
+			"When events were last fetched successfully.", float64(m.lastSuccess.Unix()))
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/microsoft"
+	"google.golang.org/api/calendar/v3"
+)
+
+// msgraphConfig is the msgraph section of a profile: the application
+// registered in Azure AD that gcal authenticates as.
+type msgraphConfig struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// Tenant defaults to "common", which allows both work and personal
+	// accounts.
+	Tenant string `json:"tenant"`
+}
+
+const graphURL = "https://graph.microsoft.com/v1.0"
+
+// msgraphProvider reads Outlook / Microsoft 365 calendars through the
+// Microsoft Graph API.
+type msgraphProvider struct {
+	client *http.Client
+}
+
+func newMSGraphProvider(ctx context.Context) (provider, error) {
+	if prof.MSGraph == nil || prof.MSGraph.ClientID == "" {
+		return nil, usageError("profile %q needs msgraph.client_id to use the msgraph provider", profilename)
+	}
+	config := &oauth2.Config{
+		ClientID:     prof.MSGraph.ClientID,
+		ClientSecret: prof.MSGraph.ClientSecret,
+		Endpoint:     microsoft.AzureADEndpoint(prof.MSGraph.Tenant),
+		Scopes:       []string{"offline_access", "Calendars.Read"},
+	}
+	client, err := getClient(config, prof.Token, getTokenFromDevice)
+	if err != nil {
+		return nil, err
+	}
+	return &msgraphProvider{client}, nil
+}
+
+// getTokenFromDevice runs the device code flow: the user signs in on any
+// browser with a short code, while we poll for the token.
+func getTokenFromDevice(config *oauth2.Config) (*oauth2.Token, error) {
+	ctx := oauthContext()
+	da, err := config.DeviceAuth(ctx)
+	if err != nil {
+		return nil, authError("unable to start device authorization: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Go to %s in your browser and enter the code %s\n",
+		da.VerificationURI, da.UserCode)
+	tok, err := config.DeviceAccessToken(ctx, da)
+	if err != nil {
+		return nil, authError("unable to retrieve token: %v", err)
+	}
+	return tok, nil
+}
+
+// get fetches a Graph resource into v.
+func (m *msgraphProvider) get(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return err
+	}
+	// Graph otherwise gives times in the mailbox's zone, by its Windows
+	// name, which Go doesn't know.
+	req.Header.Set("Prefer", `outlook.timezone="UTC"`)
+	resp, err := m.client.Do(req)
+	if err != nil {
+		if isInvalidGrant(err) {
+			return reauthError()
+		}
+		return apiError("%v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var gerr struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&gerr)
+		return apiError("GET %s: %w", u, &statusError{resp.StatusCode,
+			fmt.Sprintf("%s: %s %s", resp.Status, gerr.Error.Code, gerr.Error.Message)})
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+type graphCalendar struct {
+	ID                string `json:"id"`
+	Name              string `json:"name"`
+	IsDefaultCalendar bool   `json:"isDefaultCalendar"`
+	Owner             struct {
+		Address string `json:"address"`
+	} `json:"owner"`
+}
+
+func (m *msgraphProvider) Calendars(ctx context.Context) ([]*calendar.CalendarListEntry, error) {
+	items := make([]*calendar.CalendarListEntry, 0)
+	next := graphURL + "/me/calendars"
+	for next != "" {
+		var page struct {
+			Value    []graphCalendar `json:"value"`
+			NextLink string          `json:"@odata.nextLink"`
+		}
+		if err := m.get(ctx, next, &page); err != nil {
+			return nil, err
+		}
+		for _, cal := range page.Value {
+			// gcal names calendars by their description, and Outlook
+			// calendars only have a name.
+			items = append(items, &calendar.CalendarListEntry{
+				Id:          cal.ID,
+				Summary:     cal.Name,
+				Description: cal.Name,
+				Primary:     cal.IsDefaultCalendar,
+			})
+		}
+		next = page.NextLink
+	}
+	return items, nil
+}
+
+func (m *msgraphProvider) Primary(ctx context.Context) (*calendar.CalendarListEntry, error) {
+	var cal graphCalendar
+	if err := m.get(ctx, graphURL+"/me/calendar", &cal); err != nil {
+		return nil, err
+	}
+	return &calendar.CalendarListEntry{Id: cal.ID, Summary: cal.Name, Description: cal.Name, Primary: true}, nil
+}
+
+type graphDateTime struct {
+	DateTime string `json:"dateTime"`
+	TimeZone string `json:"timeZone"`
+}
+
+type graphEmailAddress struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+type graphEvent struct {
+	ID               string        `json:"id"`
+	ICalUID          string        `json:"iCalUId"`
+	Subject          string        `json:"subject"`
+	BodyPreview      string        `json:"bodyPreview"`
+	Start            graphDateTime `json:"start"`
+	End              graphDateTime `json:"end"`
+	IsAllDay         bool          `json:"isAllDay"`
+	IsCancelled      bool          `json:"isCancelled"`
+	ShowAs           string        `json:"showAs"`
+	Sensitivity      string        `json:"sensitivity"`
+	WebLink          string        `json:"webLink"`
+	SeriesMasterID   string        `json:"seriesMasterId"`
+	IsReminderOn     bool          `json:"isReminderOn"`
+	ReminderMinutes  int64         `json:"reminderMinutesBeforeStart"`
+	IsOrganizer      bool          `json:"isOrganizer"`
+	CreatedDateTime  string        `json:"createdDateTime"`
+	LastModifiedTime string        `json:"lastModifiedDateTime"`
+	Location         struct {
+		DisplayName string `json:"displayName"`
+	} `json:"location"`
+	ResponseStatus struct {
+		Response string `json:"response"`
+	} `json:"responseStatus"`
+	Organizer struct {
+		EmailAddress graphEmailAddress `json:"emailAddress"`
+	} `json:"organizer"`
+	Attendees []struct {
+		EmailAddress graphEmailAddress `json:"emailAddress"`
+		Status       struct {
+			Response string `json:"response"`
+		} `json:"status"`
+	} `json:"attendees"`
+	OnlineMeeting *struct {
+		JoinURL string `json:"joinUrl"`
+	} `json:"onlineMeeting"`
+}
+
+func (m *msgraphProvider) Events(ctx context.Context, calid string, start, end time.Time) ([]*calendar.Event, error) {
+	q := url.Values{}
+	q.Set("startDateTime", start.UTC().Format(time.RFC3339))
+	q.Set("endDateTime", end.UTC().Format(time.RFC3339))
+	q.Set("$orderby", "start/dateTime")
+	q.Set("$top", "100")
+	next := graphURL + "/me/calendars/" + url.PathEscape(calid) + "/calendarView?" + q.Encode()
+	events := make([]*calendar.Event, 0)
+	for next != "" {
+		var page struct {
+			Value    []graphEvent `json:"value"`
+			NextLink string       `json:"@odata.nextLink"`
+		}
+		if err := m.get(ctx, next, &page); err != nil {
+			return nil, err
+		}
+		for _, gev := range page.Value {
+			// Google leaves cancelled occurrences out too.
+			if gev.IsCancelled {
+				continue
+			}
+			ev, err := gev.toEvent()
+			if err != nil {
+				err = fmt.Errorf("event %s in calendar %s: %w", gev.ID, calid, err)
+				if strict {
+					return nil, apiError("%v", err)
+				}
+				log.Warningf("skipping %v", err)
+				continue
+			}
+			events = append(events, ev)
+		}
+		next = page.NextLink
+	}
+	return events, nil
+}
+
+// graphResponses maps Graph response values to Google's.
+var graphResponses = map[string]string{
+	"accepted":            "accepted",
+	"declined":            "declined",
+	"tentativelyAccepted": "tentative",
+	"notResponded":        "needsAction",
+	"none":                "needsAction",
+	"organizer":           "accepted",
+}
+
+func (gdt graphDateTime) toEventDateTime(allday bool) (*calendar.EventDateTime, error) {
+	loc := time.UTC
+	if gdt.TimeZone != "" && gdt.TimeZone != "UTC" {
+		l, err := time.LoadLocation(gdt.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("unknown time zone %q", gdt.TimeZone)
+		}
+		loc = l
+	}
+	t, err := time.ParseInLocation("2006-01-02T15:04:05.9999999", gdt.DateTime, loc)
+	if err != nil {
+		return nil, err
+	}
+	if allday {
+		return &calendar.EventDateTime{Date: t.Format("2006-01-02")}, nil
+	}
+	return &calendar.EventDateTime{DateTime: t.Format(time.RFC3339)}, nil
+}
+
+// toEvent converts a Graph event into the Google shape.
+func (gev *graphEvent) toEvent() (*calendar.Event, error) {
+	start, err := gev.Start.toEventDateTime(gev.IsAllDay)
+	if err != nil {
+		return nil, fmt.Errorf("bad start time: %w", err)
+	}
+	end, err := gev.End.toEventDateTime(gev.IsAllDay)
+	if err != nil {
+		return nil, fmt.Errorf("bad end time: %w", err)
+	}
+	ev := &calendar.Event{
+		Id:               gev.ID,
+		ICalUID:          gev.ICalUID,
+		Summary:          gev.Subject,
+		Description:      gev.BodyPreview,
+		Location:         gev.Location.DisplayName,
+		HtmlLink:         gev.WebLink,
+		Start:            start,
+		End:              end,
+		RecurringEventId: gev.SeriesMasterID,
+		Created:          gev.CreatedDateTime,
+		Updated:          gev.LastModifiedTime,
+		Status:           "confirmed",
+		Organizer: &calendar.EventOrganizer{
+			DisplayName: gev.Organizer.EmailAddress.Name,
+			Email:       gev.Organizer.EmailAddress.Address,
+			Self:        gev.IsOrganizer,
+		},
+	}
+	if gev.IsCancelled {
+		ev.Status = "cancelled"
+	}
+	switch gev.ShowAs {
+	case "free":
+		ev.Transparency = "transparent"
+	case "tentative":
+		ev.Status = "tentative"
+	}
+	switch gev.Sensitivity {
+	case "private", "personal":
+		ev.Visibility = "private"
+	case "confidential":
+		ev.Visibility = "confidential"
+	}
+	for _, att := range gev.Attendees {
+		ev.Attendees = append(ev.Attendees, &calendar.EventAttendee{
+			DisplayName:    att.EmailAddress.Name,
+			Email:          att.EmailAddress.Address,
+			ResponseStatus: graphResponses[att.Status.Response],
+		})
+	}
+	// Graph reports our own response separately; Google marks it on our
+	// attendee entry.
+	if status, ok := graphResponses[gev.ResponseStatus.Response]; ok && !gev.IsOrganizer {
+		ev.Attendees = append(ev.Attendees, &calendar.EventAttendee{
+			Self:           true,
+			ResponseStatus: status,
+		})
+	}
+	if gev.IsReminderOn {
+		ev.Reminders = &calendar.EventReminders{
+			Overrides: []*calendar.EventReminder{{Method: "popup", Minutes: gev.ReminderMinutes}},
+		}
+	}
+	if gev.OnlineMeeting != nil && gev.OnlineMeeting.JoinURL != "" {
+		ev.ConferenceData = &calendar.ConferenceData{
+			EntryPoints: []*calendar.EntryPoint{{EntryPointType: "video", Uri: gev.OnlineMeeting.JoinURL}},
+		}
+	}
+	return ev, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+func init() {
+	register(&command{
+		name:     "open",
+		args:     "event-id|search-term|next",
+		summary:  "Open an event in the calendar's web page",
+		complete: []string{"next"},
+		run:      runOpen,
+	})
+}
+
+// nextEvent is the timed event that is on now or starts next.
+func nextEvent(now time.Time, events []*agendaEvent) *agendaEvent {
+	for _, ev := range sortedByStart(events) {
+		if !ev.AllDay && !ev.Task && !ev.Buffer && ev.End.After(now) {
+			return ev
+		}
+	}
+	return nil
+}
+
+func runOpen(args []string) error {
+	if len(args) != 1 {
+		return usageError("usage: gcal open event-id|search-term|next")
+	}
+	if _, err := parseFilters(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	var ev *agendaEvent
+	if args[0] == "next" {
+		localzone, err := localZone()
+		if err != nil {
+			return err
+		}
+		events, _, err := agendaEvents(ctx, duration, localzone)
+		if err != nil {
+			return err
+		}
+		if ev = nextEvent(time.Now(), events); ev == nil {
+			return errNoEvents
+		}
+	} else {
+		var err error
+		if ev, err = findEvent(ctx, args[0]); err != nil {
+			return err
+		}
+	}
+	if ev.HtmlLink == "" {
+		return usageError("%s has no web page", summary(ev))
+	}
+	log.Infof("Opening %s", ev.HtmlLink)
+	if err := openURL(ev.HtmlLink); err != nil {
+		return usageError("unable to open the link: %v", err)
+	}
+	return nil
+}
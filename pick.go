@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+var pickAction string
+
+func init() {
+	register(&command{
+		name:    "pick",
+		summary: "Pick an event from a fuzzy-searchable list",
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&pickAction, "action", "details", "What Enter does with the event (details|link|copy|open)")
+		},
+		run: runPick,
+	})
+}
+
+// meetingURL matches the video call links people paste into locations
+// and descriptions.
+var meetingURL = regexp.MustCompile(`https://[^\s"<>]*(meet\.google\.com|zoom\.us|teams\.microsoft\.com|teams\.live\.com|webex\.com|whereby\.com|meet\.jit\.si)[^\s"<>]*`)
+
+// meetingLink is the link to join the event's video call, if it has one.
+func meetingLink(ev *agendaEvent) string {
+	if ev.ConferenceData != nil {
+		for _, ep := range ev.ConferenceData.EntryPoints {
+			if ep.EntryPointType == "video" && ep.Uri != "" {
+				return ep.Uri
+			}
+		}
+	}
+	if ev.HangoutLink != "" {
+		return ev.HangoutLink
+	}
+	if m := meetingURL.FindString(ev.Location); m != "" {
+		return m
+	}
+	return meetingURL.FindString(ev.Description)
+}
+
+// eventWhen says when an event is, for one-line listings.
+func eventWhen(ev *agendaEvent) string {
+	switch {
+	case ev.Task:
+		return ev.Start.Format("Mon Jan 02") + " todo "
+	case ev.AllDay:
+		return ev.Start.Format("Mon Jan 02") + " -----"
+	}
+	return ev.Start.Format("Mon Jan 02 15:04")
+}
+
+// eventDetails writes everything we know about an event.
+func eventDetails(w io.Writer, ev *agendaEvent) {
+	fmt.Fprintf(w, "%s\n", markedSummary(ev))
+	switch {
+	case ev.Task:
+		fmt.Fprintf(w, "Due:       %s\n", ev.Start.Format("Mon Jan 02 2006"))
+	case ev.AllDay:
+		fmt.Fprintf(w, "When:      %s, all day\n", ev.Start.Format("Mon Jan 02 2006"))
+	default:
+		fmt.Fprintf(w, "When:      %s-%s%s\n", ev.Start.Format("Mon Jan 02 2006 15:04"), ev.End.Format("15:04"), alsoTimes(ev))
+	}
+	if ev.Calendar != "" {
+		fmt.Fprintf(w, "Calendar:  %s\n", ev.Calendar)
+	}
+	if ev.Location != "" {
+		fmt.Fprintf(w, "Location:  %s\n", ev.Location)
+	}
+	if link := meetingLink(ev); link != "" {
+		fmt.Fprintf(w, "Join:      %s\n", link)
+	}
+	for _, ep := range dialIns(ev) {
+		fmt.Fprintf(w, "Dial-in:   %s\n", ep)
+	}
+	if ev.HtmlLink != "" {
+		fmt.Fprintf(w, "Link:      %s\n", ev.HtmlLink)
+	}
+	for _, rule := range ev.Recurrence {
+		fmt.Fprintf(w, "Repeats:   %s\n", rule)
+	}
+	if ev.Organizer != nil && (ev.Organizer.DisplayName != "" || ev.Organizer.Email != "") {
+		fmt.Fprintf(w, "Organizer: %s\n", person(ev.Organizer.DisplayName, ev.Organizer.Email))
+	}
+	for i, att := range ev.Attendees {
+		label := "Attendees:"
+		if i > 0 {
+			label = ""
+		}
+		status := ""
+		if att.ResponseStatus != "" {
+			status = " (" + att.ResponseStatus + ")"
+		}
+		fmt.Fprintf(w, "%-10s %s%s\n", label, person(att.DisplayName, att.Email), status)
+	}
+	for i, a := range ev.Attachments {
+		label := "Files:"
+		if i > 0 {
+			label = ""
+		}
+		fmt.Fprintf(w, "%-10s %s <%s>\n", label, a.Title, a.FileUrl)
+	}
+	if desc := strings.TrimSpace(ev.Description); desc != "" {
+		fmt.Fprintf(w, "\n%s\n", desc)
+	}
+}
+
+// dialIns are the ways into the event's call other than its video link:
+// phone numbers with their PINs, SIP addresses and so on.
+func dialIns(ev *agendaEvent) []string {
+	if ev.ConferenceData == nil {
+		return nil
+	}
+	eps := make([]string, 0)
+	for _, ep := range ev.ConferenceData.EntryPoints {
+		if ep.EntryPointType == "video" || ep.Uri == "" {
+			continue
+		}
+		s := ep.Uri
+		if ep.Label != "" {
+			s = ep.Label + " (" + ep.Uri + ")"
+		}
+		for _, code := range []string{ep.Pin, ep.AccessCode, ep.Passcode, ep.Password, ep.MeetingCode} {
+			if code != "" {
+				s += " PIN " + code
+				break
+			}
+		}
+		eps = append(eps, s)
+	}
+	return eps
+}
+
+func person(name, email string) string {
+	switch {
+	case name == "":
+		return email
+	case email == "":
+		return name
+	}
+	return name + " <" + email + ">"
+}
+
+// fuzzyScore reports whether the letters of query appear in order in
+// text, and how well: runs of consecutive letters and letters at the
+// start of words score higher. Matching ignores case.
+func fuzzyScore(query, text string) (int, bool) {
+	if query == "" {
+		return 0, true
+	}
+	q := []rune(strings.ToLower(query))
+	score, run := 0, 0
+	prev := ' '
+	i := 0
+	for _, r := range strings.ToLower(text) {
+		if i < len(q) && r == q[i] {
+			i++
+			run++
+			score += run
+			if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+				score += 3
+			}
+		} else {
+			run = 0
+		}
+		prev = r
+	}
+	return score, i == len(q)
+}
+
+// openURL opens a link in the desktop's browser.
+func openURL(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
+
+// copyText puts text on the clipboard with whichever clipboard tool is
+// around, or failing that, asks the terminal to with an OSC 52 escape.
+func copyText(text string) error {
+	tools := [][]string{{"pbcopy"}, {"wl-copy"}, {"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}, {"clip.exe"}}
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(tool[0], tool[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		return cmd.Run()
+	}
+	_, err := fmt.Fprintf(os.Stderr, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+	return err
+}
+
+// picker is the state of the fuzzy list.
+type picker struct {
+	events  []*agendaEvent
+	lines   []string
+	query   []rune
+	matches []int
+	cursor  int
+	// drawn is how many lines the last draw took, to clear them.
+	drawn int
+}
+
+func newPicker(events []*agendaEvent) *picker {
+	p := &picker{events: events}
+	for _, ev := range events {
+		line := eventWhen(ev) + "  " + markedSummary(ev)
+		if ev.Calendar != "" {
+			line += "  [" + ev.Calendar + "]"
+		}
+		p.lines = append(p.lines, line)
+	}
+	p.filter()
+	return p
+}
+
+func (p *picker) filter() {
+	type match struct{ i, score int }
+	found := make([]match, 0, len(p.lines))
+	for i, line := range p.lines {
+		if score, ok := fuzzyScore(string(p.query), line); ok {
+			found = append(found, match{i, score})
+		}
+	}
+	sort.SliceStable(found, func(a, b int) bool { return found[a].score > found[b].score })
+	p.matches = p.matches[:0]
+	for _, m := range found {
+		p.matches = append(p.matches, m.i)
+	}
+	p.cursor = 0
+}
+
+// draw renders the prompt and the matches that fit in height lines.
+func (p *picker) draw(w io.Writer, width, height int) {
+	var buf bytes.Buffer
+	if p.drawn > 1 {
+		fmt.Fprintf(&buf, "\x1b[%dA", p.drawn-1)
+	}
+	buf.WriteString("\r\x1b[J")
+	rows := max(0, min(len(p.matches), height-1))
+	first := max(0, p.cursor-rows+1)
+	for i := first; i < first+rows; i++ {
+		line := truncateRunes(p.lines[p.matches[i]], width-2)
+		if i == p.cursor {
+			fmt.Fprintf(&buf, "\x1b[7m> %s\x1b[0m\r\n", line)
+		} else {
+			fmt.Fprintf(&buf, "  %s\r\n", line)
+		}
+	}
+	fmt.Fprintf(&buf, "%d/%d > %s", len(p.matches), len(p.lines), string(p.query))
+	p.drawn = rows + 1
+	w.Write(buf.Bytes())
+}
+
+func truncateRunes(s string, n int) string {
+	if n < 1 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
+
+// Keys the picker reads in raw mode.
+const (
+	keyCtrlC     = 3
+	keyCtrlJ     = 10
+	keyCtrlK     = 11
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlO     = 15
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlY     = 25
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// run lets the user pick an event, and returns it along with the action
+// to take on it, or nil if they gave up.
+func (p *picker) run(in io.Reader, out io.Writer, size func() (int, int)) (*agendaEvent, string, error) {
+	buf := make([]byte, 64)
+	for {
+		width, height := size()
+		p.draw(out, width, min(height, 20))
+		n, err := in.Read(buf)
+		if err != nil {
+			return nil, "", err
+		}
+		key := buf[:n]
+		action := ""
+		switch {
+		case n == 1 && (key[0] == keyCtrlC || key[0] == keyEscape):
+			return nil, "", nil
+		case n == 1 && key[0] == keyEnter:
+			action = pickAction
+		case n == 1 && key[0] == keyCtrlO:
+			action = "open"
+		case n == 1 && key[0] == keyCtrlY:
+			action = "copy"
+		case bytes.Equal(key, []byte("\x1b[A")) || n == 1 && (key[0] == keyCtrlP || key[0] == keyCtrlK):
+			if p.cursor > 0 {
+				p.cursor--
+			}
+		case bytes.Equal(key, []byte("\x1b[B")) || n == 1 && (key[0] == keyCtrlN || key[0] == keyCtrlJ):
+			if p.cursor < len(p.matches)-1 {
+				p.cursor++
+			}
+		case n == 1 && (key[0] == keyBackspace || key[0] == '\b'):
+			if len(p.query) > 0 {
+				p.query = p.query[:len(p.query)-1]
+				p.filter()
+			}
+		case n == 1 && key[0] == keyCtrlU:
+			p.query = p.query[:0]
+			p.filter()
+		case key[0] != keyEscape:
+			for _, r := range string(key) {
+				if unicode.IsPrint(r) {
+					p.query = append(p.query, r)
+				}
+			}
+			p.filter()
+		}
+		if action != "" && len(p.matches) > 0 {
+			return p.events[p.matches[p.cursor]], action, nil
+		}
+	}
+}
+
+func runPick(args []string) error {
+	switch pickAction {
+	case "details", "link", "copy", "open":
+	default:
+		return usageError("-action must be details, link, copy or open, not %s", pickAction)
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) || !term.IsTerminal(int(os.Stderr.Fd())) {
+		return usageError("gcal pick needs a terminal")
+	}
+	if _, err := parseFilters(); err != nil {
+		return err
+	}
+	if err := loadAlsoZones(); err != nil {
+		return err
+	}
+	localzone, err := localZone()
+	if err != nil {
+		return err
+	}
+	events, _, err := agendaEvents(context.Background(), duration, localzone)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return errNoEvents
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return usageError("unable to read the terminal: %v", err)
+	}
+	p := newPicker(sortedByStart(events))
+	ev, action, err := p.run(os.Stdin, os.Stderr, func() (int, int) {
+		w, h, err := term.GetSize(int(os.Stderr.Fd()))
+		if err != nil || w < 10 || h < 2 {
+			return 80, 24
+		}
+		return w, h
+	})
+	// Clear the list before handing the terminal back.
+	if p.drawn > 1 {
+		fmt.Fprintf(os.Stderr, "\x1b[%dA", p.drawn-1)
+	}
+	fmt.Fprint(os.Stderr, "\r\x1b[J")
+	term.Restore(fd, state)
+	if err != nil || ev == nil {
+		return err
+	}
+	return pickDone(ev, action)
+}
+
+// pickDone does what was asked with the picked event.
+func pickDone(ev *agendaEvent, action string) error {
+	link := meetingLink(ev)
+	if link == "" {
+		link = ev.HtmlLink
+	}
+	switch action {
+	case "details":
+		eventDetails(os.Stdout, ev)
+		return nil
+	}
+	if link == "" {
+		return usageError("%s has no link", summary(ev))
+	}
+	switch action {
+	case "link":
+		fmt.Println(link)
+	case "copy":
+		if err := copyText(link); err != nil {
+			return usageError("unable to copy the link: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "copied %s\n", link)
+	case "open":
+		if err := openURL(link); err != nil {
+			return usageError("unable to open the link: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		query, text string
+		match       bool
+	}{
+		{"", "anything", true},
+		{"std", "Standup", true},
+		{"STAND", "standup", true},
+		{"bdg rev", "Budget review", true},
+		{"réu", "Réunion d'équipe", true},
+		{"xyz", "Standup", false},
+		{"pu", "Standup", false},
+		{"standups", "Standup", false},
+	}
+	for _, tt := range tests {
+		if _, ok := fuzzyScore(tt.query, tt.text); ok != tt.match {
+			t.Errorf("fuzzyScore(%q, %q) matches = %v, want %v", tt.query, tt.text, ok, tt.match)
+		}
+	}
+}
+
+func TestFuzzyScoreRanks(t *testing.T) {
+	// Each query should score higher on the first text than the second.
+	tests := []struct {
+		query, better, worse string
+	}{
+		// Consecutive letters beat scattered ones.
+		{"bud", "Budget review", "Rebuild"},
+		// Letters at the start of words beat letters within them.
+		{"br", "Budget review", "Bar"},
+		{"one", "1:1 with Oneida", "Phone call"},
+	}
+	for _, tt := range tests {
+		better, ok1 := fuzzyScore(tt.query, tt.better)
+		worse, ok2 := fuzzyScore(tt.query, tt.worse)
+		if !ok1 || !ok2 || better <= worse {
+			t.Errorf("fuzzyScore(%q): %q scores %d, %q scores %d", tt.query, tt.better, better, tt.worse, worse)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	postWebhook string
+	postStyle   string
+)
+
+func init() {
+	register(&command{
+		name:    "post",
+		summary: "Post the agenda to a Slack or Discord webhook",
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&postWebhook, "webhook", "", "Webhook URL (default $GCAL_WEBHOOK_URL)")
+			fs.StringVar(&postStyle, "style", "slack", "Message style (slack|discord)")
+		},
+		run: runPost,
+	})
+}
+
+// postDay is a day of the agenda as chat lines.
+type postDay struct {
+	Title string
+	Lines []string
+}
+
+// chatDays groups the events by day, each as a line of chat markup made
+// by line.
+func chatDays(events []*agendaEvent, line func(*agendaEvent) string) []postDay {
+	days := make([]postDay, 0)
+	for _, ev := range sortedByStart(events) {
+		title := localDate(ev.Start, "Monday, January 2")
+		if n := len(days); n == 0 || days[n-1].Title != title {
+			days = append(days, postDay{Title: title})
+		}
+		days[len(days)-1].Lines = append(days[len(days)-1].Lines, line(ev))
+	}
+	return days
+}
+
+func chatWhen(ev *agendaEvent) string {
+	switch {
+	case ev.Task:
+		return "todo"
+	case ev.AllDay:
+		return "all day"
+	}
+	return ev.Start.Format("15:04") + "-" + ev.End.Format("15:04")
+}
+
+// truncate cuts s to at most n bytes, on a line boundary if it can.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	cut := n - len("\n…")
+	// Don't split a character.
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	s = s[:cut]
+	if i := strings.LastIndex(s, "\n"); i > 0 {
+		s = s[:i]
+	}
+	return s + "\n…"
+}
+
+var slackEscape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace
+
+// slackMessage is the agenda as Slack blocks: a header, then a section
+// per day.
+func slackMessage(title string, events []*agendaEvent) interface{} {
+	type text struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	type block struct {
+		Type string `json:"type"`
+		Text *text  `json:"text,omitempty"`
+	}
+	blocks := []block{{Type: "header", Text: &text{"plain_text", title}}}
+	days := chatDays(events, func(ev *agendaEvent) string {
+		s := fmt.Sprintf("`%s` %s", chatWhen(ev), slackEscape(markedSummary(ev)+alsoTimes(ev)))
+		if ev.HtmlLink != "" {
+			s = fmt.Sprintf("`%s` <%s|%s>", chatWhen(ev), ev.HtmlLink, slackEscape(markedSummary(ev)+alsoTimes(ev)))
+		}
+		if ev.Calendar != "" {
+			s += " _" + slackEscape(ev.Calendar) + "_"
+		}
+		return s
+	})
+	for _, day := range days {
+		// Slack takes at most 3000 characters in a section.
+		blocks = append(blocks, block{Type: "section",
+			Text: &text{"mrkdwn", truncate("*"+day.Title+"*\n"+strings.Join(day.Lines, "\n"), 3000)}})
+	}
+	if len(days) == 0 {
+		blocks = append(blocks, block{Type: "section", Text: &text{"mrkdwn", "Nothing scheduled."}})
+	}
+	// Slack allows 50 blocks.
+	if len(blocks) > 50 {
+		blocks = blocks[:50]
+	}
+	return map[string]interface{}{"text": title, "blocks": blocks}
+}
+
+// discordMessage is the agenda as a Discord embed, with a field per day.
+func discordMessage(title string, events []*agendaEvent) interface{} {
+	type field struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	type embed struct {
+		Title       string  `json:"title"`
+		Description string  `json:"description,omitempty"`
+		Fields      []field `json:"fields,omitempty"`
+	}
+	e := embed{Title: title}
+	days := chatDays(events, func(ev *agendaEvent) string {
+		s := fmt.Sprintf("`%s` %s", chatWhen(ev), markdownEscape(markedSummary(ev)+alsoTimes(ev)))
+		if ev.HtmlLink != "" {
+			s = fmt.Sprintf("`%s` [%s](%s)", chatWhen(ev), markdownEscape(markedSummary(ev)+alsoTimes(ev)), ev.HtmlLink)
+		}
+		if ev.Calendar != "" {
+			s += " *" + markdownEscape(ev.Calendar) + "*"
+		}
+		return s
+	})
+	// Discord takes at most 25 fields of 1024 characters, and 6000
+	// characters in all. The days past that are left out, saying so in
+	// a last field.
+	total := len(title)
+	for i, day := range days {
+		f := field{day.Title, truncate(strings.Join(day.Lines, "\n"), 1024)}
+		size := len(f.Name) + len(f.Value)
+		more := field{"…and " + plural(len(days)-i, "more day"), "Too much for one message."}
+		fits := len(e.Fields) < 25 && total+size <= 6000
+		if i < len(days)-1 {
+			// Keep room to say what's left out.
+			fits = len(e.Fields) < 24 && total+size+len(more.Name)+len(more.Value) <= 6000
+		}
+		if !fits {
+			e.Fields = append(e.Fields, more)
+			break
+		}
+		e.Fields = append(e.Fields, f)
+		total += size
+	}
+	if len(days) == 0 {
+		e.Description = "Nothing scheduled."
+	}
+	return map[string]interface{}{"embeds": []embed{e}}
+}
+
+var postStyles = map[string]func(string, []*agendaEvent) interface{}{
+	"slack":   slackMessage,
+	"discord": discordMessage,
+}
+
+func runPost(args []string) error {
+	sharedOutput = true
+	message, ok := postStyles[postStyle]
+	if !ok {
+		return usageError("-style must be slack or discord, not %s", postStyle)
+	}
+	webhook := postWebhook
+	if webhook == "" {
+		webhook = os.Getenv("GCAL_WEBHOOK_URL")
+	}
+	if webhook == "" {
+		return usageError("no -webhook given")
+	}
+	if _, err := parseFilters(); err != nil {
+		return err
+	}
+	if err := loadAlsoZones(); err != nil {
+		return err
+	}
+	localzone, err := localZone()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	events, _, err := agendaEvents(ctx, duration, localzone)
+	if err != nil {
+		return err
+	}
+
+	title := "Agenda for " + localDate(time.Now().In(localzone), "Monday, January 2")
+	payload, err := json.Marshal(message(title, events))
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		fmt.Fprintf(dryRunOut, "%s\n", payload)
+	}
+	// The webhook URL is a secret, so keep it out of the output.
+	return mutate("post the agenda to the "+postStyle+" webhook", func() error {
+		return postJSON(ctx, webhook, payload)
+	})
+}
+
+func postJSON(ctx context.Context, url string, payload []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return usageError("bad webhook URL: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient(0).Do(req)
+	if err != nil {
+		return apiError("unable to post to the webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return apiError("the webhook answered %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+var (
+	busyOnly    bool
+	privateMode string
+	// sharedOutput is set by the commands whose output others see, where
+	// -private auto masks private events.
+	sharedOutput bool
+)
+
+func init() {
+	flag.BoolVar(&busyOnly, "busy-only", false, "Skip events that leave you free, such as focus blocks")
+	flag.StringVar(&privateMode, "private", "auto", "Private events: mask, show, or auto to mask them in serve and post")
+}
+
+func checkPrivateMode() error {
+	switch privateMode {
+	case "auto", "mask", "show":
+		return nil
+	}
+	return usageError("-private must be mask, show or auto, not %s", privateMode)
+}
+
+// isPrivate reports whether only the event's owner should see what it
+// is about.
+func isPrivate(ev *agendaEvent) bool {
+	return ev.Visibility == "private" || ev.Visibility == "confidential"
+}
+
+func maskingPrivate() bool {
+	return privateMode == "mask" || privateMode == "auto" && sharedOutput
+}
+
+// maskPrivate replaces private events by copies that only say when we
+// are busy.
+func maskPrivate(events []*agendaEvent) []*agendaEvent {
+	masked := make([]*agendaEvent, 0, len(events))
+	for _, ev := range events {
+		if !isPrivate(ev) {
+			masked = append(masked, ev)
+			continue
+		}
+		copied := *ev
+		copied.Event = &calendar.Event{
+			Id:           ev.Id,
+			Summary:      "Busy",
+			Start:        ev.Event.Start,
+			End:          ev.Event.End,
+			Status:       ev.Status,
+			Transparency: ev.Transparency,
+			Visibility:   ev.Visibility,
+		}
+		for _, att := range ev.Attendees {
+			if att.Self {
+				copied.Attendees = []*calendar.EventAttendee{{Self: true, ResponseStatus: att.ResponseStatus}}
+			}
+		}
+		settings := *ev.Settings
+		settings.Prefix = ""
+		copied.Settings = &settings
+		masked = append(masked, &copied)
+	}
+	return masked
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// A provider is a calendar service we can read events from. Whatever the
+// service, calendars and events are handed back as their Google Calendar
+// API equivalents, so that everything downstream only knows about one
+// shape of event.
+type provider interface {
+	// Calendars lists the calendars the user can see.
+	Calendars(ctx context.Context) ([]*calendar.CalendarListEntry, error)
+	// Events lists the events of one calendar overlapping [start, end),
+	// with recurring events expanded into their instances.
+	Events(ctx context.Context, calid string, start, end time.Time) ([]*calendar.Event, error)
+}
+
+// A writer is a provider that can also change events. Only Google is,
+// and only with a token that has write access.
+type writer interface {
+	// Respond answers an invitation: accepted, tentative or declined.
+	Respond(ctx context.Context, ev *agendaEvent, status string) error
+	// Delete removes an event.
+	Delete(ctx context.Context, ev *agendaEvent) error
+	// QuickAdd creates an event from a description such as "Lunch with
+	// Sam tomorrow at noon".
+	QuickAdd(ctx context.Context, calid, text string) (*calendar.Event, error)
+	// Insert creates an event.
+	Insert(ctx context.Context, calid string, ev *calendar.Event) (*calendar.Event, error)
+}
+
+// A primaryGetter is a provider that can tell its user's main calendar
+// without listing them all.
+type primaryGetter interface {
+	Primary(ctx context.Context) (*calendar.CalendarListEntry, error)
+}
+
+// An eventGetter is a provider that can look up a single event, such as
+// the series an instance of a recurring event belongs to.
+type eventGetter interface {
+	Event(ctx context.Context, calid, id string) (*calendar.Event, error)
+}
+
+// providers maps the names accepted by -provider to constructors.
+var providers = map[string]func(ctx context.Context) (provider, error){
+	"google":  newGoogleProvider,
+	"msgraph": newMSGraphProvider,
+	"caldav":  newCalDAVProvider,
+	// none is for working from iCalendar files alone, offline.
+	"none": func(ctx context.Context) (provider, error) { return noProvider{}, nil },
+}
+
+// newProvider returns the provider selected by the profile.
+func newProvider(ctx context.Context) (provider, error) {
+	if replayDir != "" {
+		return replayProvider{replayDir}, nil
+	}
+	return providers[prof.Provider](ctx)
+}
+
+// sources returns every provider events should be read from: the
+// profile's provider, then its iCalendar feeds and any -ics-file. With
+// -replay, the feeds were saved along with the rest.
+func sources(ctx context.Context) ([]provider, error) {
+	p, err := newProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ps := []provider{p}
+	if replayDir != "" {
+		return ps, nil
+	}
+	feeds := append([]icsSource{}, prof.ICS...)
+	for _, path := range icsFiles {
+		feeds = append(feeds, icsSource{URL: path})
+	}
+	if len(feeds) > 0 {
+		ps = append(ps, newICSProvider(feeds))
+	}
+	return ps, nil
+}
+
+// noProvider has no calendars at all.
+type noProvider struct{}
+
+func (noProvider) Calendars(ctx context.Context) ([]*calendar.CalendarListEntry, error) {
+	return nil, nil
+}
+
+func (noProvider) Events(ctx context.Context, calid string, start, end time.Time) ([]*calendar.Event, error) {
+	return nil, nil
+}
+
+type googleProvider struct {
+	srv *calendar.Service
+}
+
+func newGoogleProvider(ctx context.Context) (provider, error) {
+	srv, err := calendarService(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &googleProvider{srv}, nil
+}
+
+func (g *googleProvider) Calendars(ctx context.Context) ([]*calendar.CalendarListEntry, error) {
+	calendar_list, err := g.srv.CalendarList.List().Context(ctx).Do()
+	if err != nil {
+		return nil, requestError(err, "unable to retrieve calendar list")
+	}
+	return calendar_list.Items, nil
+}
+
+func (g *googleProvider) Primary(ctx context.Context) (*calendar.CalendarListEntry, error) {
+	cal, err := g.srv.Calendars.Get("primary").Context(ctx).Do()
+	if err != nil {
+		return nil, requestError(err, "unable to retrieve the primary calendar")
+	}
+	return &calendar.CalendarListEntry{
+		Id:          cal.Id,
+		Summary:     cal.Summary,
+		Description: cal.Description,
+		TimeZone:    cal.TimeZone,
+		Primary:     true,
+	}, nil
+}
+
+func (g *googleProvider) Events(ctx context.Context, calid string, start, end time.Time) ([]*calendar.Event, error) {
+	events2return := make([]*calendar.Event, 0)
+	call := g.srv.Events.List(calid).ShowDeleted(false).
+		SingleEvents(!noExpand).TimeMin(start.Format(time.RFC3339)).TimeMax(end.Format(time.RFC3339))
+	if !noExpand {
+		// Series can only be ordered by when they were last updated.
+		call = call.OrderBy("startTime")
+	}
+	err := call.Pages(ctx, func(events *calendar.Events) error {
+		events2return = append(events2return, events.Items...)
+		return nil
+	})
+	if err != nil {
+		return nil, requestError(err, "unable to retrieve events from calendar %s", calid)
+	}
+	return events2return, nil
+}
+
+func (g *googleProvider) Event(ctx context.Context, calid, id string) (*calendar.Event, error) {
+	ev, err := g.srv.Events.Get(calid, id).Context(ctx).Do()
+	if err != nil {
+		return nil, requestError(err, "unable to retrieve event %s", id)
+	}
+	return ev, nil
+}
+
+func (g *googleProvider) Respond(ctx context.Context, ev *agendaEvent, status string) error {
+	attendees := make([]*calendar.EventAttendee, 0, len(ev.Attendees))
+	found := false
+	for _, att := range ev.Attendees {
+		copied := *att
+		if att.Self {
+			copied.ResponseStatus = status
+			found = true
+		}
+		attendees = append(attendees, &copied)
+	}
+	if !found {
+		return usageError("you are not invited to %s", summary(ev))
+	}
+	return mutate(fmt.Sprintf("answer %s to %q", status, summary(ev)), func() error {
+		_, err := g.srv.Events.Patch(ev.CalendarID, ev.Id, &calendar.Event{Attendees: attendees}).
+			SendUpdates("all").Context(ctx).Do()
+		if err != nil {
+			return requestError(err, "unable to answer the invitation")
+		}
+		return nil
+	})
+}
+
+func (g *googleProvider) Delete(ctx context.Context, ev *agendaEvent) error {
+	return mutate(fmt.Sprintf("delete %q", summary(ev)), func() error {
+		if err := g.srv.Events.Delete(ev.CalendarID, ev.Id).Context(ctx).Do(); err != nil {
+			return requestError(err, "unable to delete the event")
+		}
+		return nil
+	})
+}
+
+func (g *googleProvider) Insert(ctx context.Context, calid string, ev *calendar.Event) (*calendar.Event, error) {
+	created := ev
+	err := mutate(fmt.Sprintf("create event %q in calendar %s", ev.Summary, calid), func() error {
+		var err error
+		if created, err = g.srv.Events.Insert(calid, ev).Context(ctx).Do(); err != nil {
+			return requestError(err, "unable to create the event")
+		}
+		return nil
+	})
+	return created, err
+}
+
+func (g *googleProvider) QuickAdd(ctx context.Context, calid, text string) (*calendar.Event, error) {
+	created := &calendar.Event{Summary: text}
+	err := mutate(fmt.Sprintf("create %q in calendar %s", text, calid), func() error {
+		var err error
+		if created, err = g.srv.Events.QuickAdd(calid, text).Context(ctx).Do(); err != nil {
+			return requestError(err, "unable to create the event")
+		}
+		return nil
+	})
+	return created, err
+}
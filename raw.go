@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+var (
+	dumpRaw   string
+	replayDir string
+)
+
+func init() {
+	flag.StringVar(&dumpRaw, "dump-raw", "", "Save the calendar list and each calendar's events, as the API returned them, into this directory")
+	flag.StringVar(&replayDir, "replay", "", "Read the calendars and events saved with -dump-raw from this directory instead of the provider")
+}
+
+// rawCalendarsFile is the calendar list in a -dump-raw directory.
+const rawCalendarsFile = "calendars.json"
+
+// rawEventsFile is the file a calendar's events are saved in. Calendar
+// ids are email addresses or URLs, so they are escaped.
+func rawEventsFile(dir, calid string) string {
+	return filepath.Join(dir, "events-"+url.PathEscape(calid)+".json")
+}
+
+func writeRaw(path string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = mutate("create directory "+filepath.Dir(path), func() error {
+		return os.MkdirAll(filepath.Dir(path), 0755)
+	})
+	if err != nil {
+		return err
+	}
+	return writeFile(path, append(b, '\n'), 0644)
+}
+
+// dumpCalendars saves the calendar list for -dump-raw.
+func dumpCalendars(list []*calendar.CalendarListEntry) {
+	if dumpRaw == "" {
+		return
+	}
+	path := filepath.Join(dumpRaw, rawCalendarsFile)
+	if err := writeRaw(path, &calendar.CalendarList{Items: list}); err != nil {
+		log.Warningf("unable to save the calendar list: %v", err)
+	}
+}
+
+// dumpEvents saves a calendar's events for -dump-raw, in the shape of
+// an Events.List response.
+func dumpEvents(calid string, start, end time.Time, events []*calendar.Event) {
+	if dumpRaw == "" {
+		return
+	}
+	page := &calendar.Events{
+		Summary: calid,
+		// Where the events came from, for whoever reads the file.
+		Description: "events from " + start.Format(time.RFC3339) + " to " + end.Format(time.RFC3339),
+		Items:       events,
+	}
+	if err := writeRaw(rawEventsFile(dumpRaw, calid), page); err != nil {
+		log.Warningf("unable to save the events of calendar %s: %v", calid, err)
+	}
+}
+
+// replayProvider reads back what -dump-raw saved, offline. The events are
+// those of the window they were saved for, whatever window is asked for
+// now.
+type replayProvider struct {
+	dir string
+}
+
+func readRaw(path string, v interface{}) error {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return usageError("%s: not saved with -dump-raw", path)
+	}
+	if err != nil {
+		return usageError("unable to read %s: %v", path, err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return usageError("%s: %v", path, err)
+	}
+	return nil
+}
+
+func (r replayProvider) Calendars(ctx context.Context) ([]*calendar.CalendarListEntry, error) {
+	var list calendar.CalendarList
+	if err := readRaw(filepath.Join(r.dir, rawCalendarsFile), &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func (r replayProvider) Primary(ctx context.Context) (*calendar.CalendarListEntry, error) {
+	list, err := r.Calendars(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range list {
+		if item.Primary {
+			return item, nil
+		}
+	}
+	return nil, usageError("%s has no primary calendar", r.dir)
+}
+
+func (r replayProvider) Events(ctx context.Context, calid string, start, end time.Time) ([]*calendar.Event, error) {
+	var page calendar.Events
+	if err := readRaw(rawEventsFile(r.dir, calid), &page); err != nil {
+		// Like a calendar that can't be read, rather than the whole run.
+		return nil, apiError("%v", err)
+	}
+	return page.Items, nil
+}
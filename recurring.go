@@ -0,0 +1,221 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+var noExpand bool
+
+func init() {
+	flag.BoolVar(&noExpand, "no-expand", false, "Write recurring events once, with their recurrence, in the remind and org formats")
+}
+
+// checkNoExpand makes sure -no-expand can be honoured: only the remind
+// and org formats can say that an event recurs, and only Google and
+// iCalendar feeds give us recurring events whole.
+func checkNoExpand() error {
+	if !noExpand {
+		return nil
+	}
+	if format != "remind" && format != "org" {
+		return usageError("-no-expand only works with the remind and org formats")
+	}
+	if prof.Provider != "google" && prof.Provider != "none" {
+		return usageError("-no-expand doesn't work with the %s provider", prof.Provider)
+	}
+	return nil
+}
+
+// exceptionDate is the day an instance of a recurring event was to be on
+// before it was cancelled or moved.
+func exceptionDate(ev *calendar.Event, localzone *time.Location) (time.Time, bool) {
+	t, allday, err := parseEventTime(ev.OriginalStartTime)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if allday {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, localzone), true
+	}
+	return t.In(localzone), true
+}
+
+// isException tells whether the series has no instance on t's day any
+// more.
+func isException(ev *agendaEvent, t time.Time) bool {
+	for _, ex := range ev.Exceptions {
+		if sameDay(ex, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// seriesRule is the recurrence of a series if it is a single RRULE,
+// along with its EXDATEs, and nil if there is more to it.
+func seriesRule(ev *agendaEvent, localzone *time.Location) (*rrule, []time.Time) {
+	var rule *rrule
+	exdates := make([]time.Time, 0)
+	for _, line := range ev.Recurrence {
+		p, err := parseICSLine(line)
+		if err != nil {
+			return nil, nil
+		}
+		switch p.Name {
+		case "RRULE":
+			if rule != nil {
+				return nil, nil
+			}
+			if rule, err = parseRRule(p.Value, localzone); err != nil {
+				return nil, nil
+			}
+		case "EXDATE":
+			for _, value := range strings.Split(p.Value, ",") {
+				t, _, err := icsTime(&icsProperty{Name: p.Name, Params: p.Params, Value: value}, localzone)
+				if err != nil {
+					return nil, nil
+				}
+				exdates = append(exdates, t.In(localzone))
+			}
+		default:
+			return nil, nil
+		}
+	}
+	if rule == nil || rule.count > 0 || len(rule.bymonth) > 0 {
+		return nil, nil
+	}
+	return rule, exdates
+}
+
+// remindSeries is the trigger of the REM line for a recurring event: the
+// days it is on, FROM its first instance and UNTIL its last, and a
+// SATISFY clause leaving out the instances that were cancelled or moved.
+// It returns false for the rules that take more than that to say.
+func remindSeries(ev *agendaEvent) (trigger, satisfy string, ok bool) {
+	r, exdates := seriesRule(ev, ev.Start.Location())
+	if r == nil {
+		return "", "", false
+	}
+	first := remindFullDate(ev.Start)
+	weekdays := make([]string, 0, len(r.byday))
+	for _, bd := range r.byday {
+		weekdays = append(weekdays, bd.wd.String()[:3])
+	}
+	switch {
+	case r.freq == "DAILY" && len(r.byday) == 0 && len(r.bymonthday) == 0:
+		trigger = fmt.Sprintf("%s *%d", first, r.interval)
+	case r.freq == "WEEKLY" && len(r.bymonthday) == 0 && r.interval == 1 &&
+		// Repeating every 7 days only says a single weekday, that of
+		// the first instance.
+		(remindWeekly == "weekday" || len(r.byday) > 1 ||
+			(len(r.byday) == 1 && r.byday[0].wd != ev.Start.Weekday())):
+		if len(weekdays) == 0 {
+			weekdays = append(weekdays, ev.Start.Weekday().String()[:3])
+		}
+		trigger = strings.Join(weekdays, " ") + " FROM " + first
+	case r.freq == "WEEKLY" && len(r.bymonthday) == 0 && len(r.byday) <= 1 &&
+		(len(r.byday) == 0 || r.byday[0].wd == ev.Start.Weekday()):
+		trigger = fmt.Sprintf("%s *%d", first, 7*r.interval)
+	case r.freq == "MONTHLY" && r.interval == 1 && len(r.byday) == 0 && len(r.bymonthday) <= 1:
+		day := ev.Start.Day()
+		if len(r.bymonthday) == 1 {
+			day = r.bymonthday[0]
+		}
+		if day < 1 {
+			return "", "", false
+		}
+		trigger = fmt.Sprintf("%d FROM %s", day, first)
+	case r.freq == "MONTHLY" && r.interval == 1 && len(r.byday) == 1 && len(r.bymonthday) == 0:
+		// The nth weekday is the first one on or after day 7(n-1)+1,
+		// and the last one the first of next month's, a week back.
+		switch n := r.byday[0].n; {
+		case n >= 1 && n <= 4:
+			trigger = fmt.Sprintf("%s %d FROM %s", weekdays[0], 7*(n-1)+1, first)
+		case n == -1:
+			trigger = fmt.Sprintf("%s 1 --7 FROM %s", weekdays[0], first)
+		default:
+			return "", "", false
+		}
+	case r.freq == "YEARLY" && r.interval == 1 && len(r.byday) == 0 && len(r.bymonthday) == 0:
+		trigger = ev.Start.Format("Jan 2") + " FROM " + first
+	default:
+		return "", "", false
+	}
+	if !r.until.IsZero() {
+		trigger += " UNTIL " + remindFullDate(r.until.In(ev.Start.Location()))
+	}
+	skipped := make([]string, 0, len(ev.Exceptions)+len(exdates))
+	for _, t := range append(append([]time.Time{}, ev.Exceptions...), exdates...) {
+		skipped = append(skipped, fmt.Sprintf("trigdate() != '%s'", t.Format("2006-01-02")))
+	}
+	if len(skipped) > 0 {
+		satisfy = " SATISFY [" + strings.Join(skipped, " && ") + "]"
+	}
+	return trigger, satisfy, true
+}
+
+// orgUnits are the org repeater units for the frequencies.
+var orgUnits = map[string]string{"DAILY": "d", "WEEKLY": "w", "MONTHLY": "m", "YEARLY": "y"}
+
+// orgRepeater is the repeater to put in the timestamp of a recurring
+// event, as in +1w. Org repeaters go on forever, on the day of the
+// timestamp, so it returns false for the series that end, skip
+// instances, or recur on other days.
+func orgRepeater(ev *agendaEvent) (string, bool) {
+	r, exdates := seriesRule(ev, ev.Start.Location())
+	if r == nil || !r.until.IsZero() || len(exdates) > 0 || len(ev.Exceptions) > 0 {
+		return "", false
+	}
+	if len(r.byday) > 1 || (len(r.byday) == 1 && (r.byday[0].n != 0 || r.byday[0].wd != ev.Start.Weekday())) {
+		return "", false
+	}
+	if len(r.bymonthday) > 1 || (len(r.bymonthday) == 1 && r.bymonthday[0] != ev.Start.Day()) {
+		return "", false
+	}
+	if r.freq == "DAILY" && len(r.byday) > 0 {
+		return "", false
+	}
+	return fmt.Sprintf(" +%d%s", r.interval, orgUnits[r.freq]), true
+}
+
+// expandSeries replaces the recurring events the format can't say by
+// their instances in the window they were read in, without the cancelled
+// and moved ones, whose replacements are among the events already.
+func expandSeries(events []*agendaEvent, canSay func(*agendaEvent) bool) ([]*agendaEvent, error) {
+	localzone, err := localZone()
+	if err != nil {
+		return nil, err
+	}
+	expanded := make([]*agendaEvent, 0, len(events))
+	for _, ev := range events {
+		if len(ev.Recurrence) == 0 || canSay(ev) {
+			expanded = append(expanded, ev)
+			continue
+		}
+		instances, err := expandRecurrence(ev.Event, ev.WindowEnd, localzone)
+		if err != nil {
+			err = fmt.Errorf("event %s: %w", ev.Id, err)
+			if strict {
+				return nil, apiError("%v", err)
+			}
+			log.Warningf("skipping %v", err)
+			continue
+		}
+		for _, inst := range instances {
+			evstart, evend, allday, err := eventSpan(inst, localzone)
+			if err != nil || !evend.After(ev.WindowStart) || isException(ev, evstart) {
+				continue
+			}
+			copied := *ev
+			copied.Event = inst
+			copied.Start, copied.End, copied.AllDay = evstart, evend, allday
+			copied.Exceptions = nil
+			expanded = append(expanded, &copied)
+		}
+	}
+	return expanded, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestExpandSeries(t *testing.T) {
+	localzone := testNow(t).Location()
+	series := &agendaEvent{
+		Event: &calendar.Event{
+			Id:         "standup",
+			Summary:    "Standup",
+			Start:      &calendar.EventDateTime{DateTime: "2025-02-24T10:00:00-05:00", TimeZone: "America/Montreal"},
+			End:        &calendar.EventDateTime{DateTime: "2025-02-24T10:15:00-05:00", TimeZone: "America/Montreal"},
+			Recurrence: []string{"RRULE:FREQ=WEEKLY"},
+		},
+		Calendar: "Me",
+		Start:    time.Date(2025, 2, 24, 10, 0, 0, 0, localzone),
+		End:      time.Date(2025, 2, 24, 10, 15, 0, 0, localzone),
+		// The instance of March 10 was moved, and is among the events
+		// on its own.
+		Exceptions:  []time.Time{time.Date(2025, 3, 10, 0, 0, 0, 0, localzone)},
+		WindowStart: time.Date(2025, 3, 3, 0, 0, 0, 0, localzone),
+		WindowEnd:   time.Date(2025, 3, 24, 0, 0, 0, 0, localzone),
+	}
+	moved := &agendaEvent{
+		Event: &calendar.Event{
+			Id:               "standup_20250310T140000Z",
+			RecurringEventId: "standup",
+			Summary:          "Standup",
+		},
+		Start: time.Date(2025, 3, 11, 10, 0, 0, 0, localzone),
+		End:   time.Date(2025, 3, 11, 10, 15, 0, 0, localzone),
+	}
+
+	expanded, err := expandSeries([]*agendaEvent{series, moved}, func(*agendaEvent) bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		id    string
+		start time.Time
+	}{
+		{"standup_20250303T150000Z", time.Date(2025, 3, 3, 10, 0, 0, 0, localzone)},
+		{"standup_20250317T140000Z", time.Date(2025, 3, 17, 10, 0, 0, 0, localzone)},
+		{"standup_20250310T140000Z", time.Date(2025, 3, 11, 10, 0, 0, 0, localzone)},
+	}
+	if len(expanded) != len(want) {
+		t.Fatalf("got %d events, want %d", len(expanded), len(want))
+	}
+	for i, w := range want {
+		ev := expanded[i]
+		if ev.Id != w.id || !ev.Start.Equal(w.start) {
+			t.Errorf("event %d is %s at %v, want %s at %v", i, ev.Id, ev.Start, w.id, w.start)
+		}
+		if ev.Exceptions != nil {
+			t.Errorf("event %d kept the exceptions of the series", i)
+		}
+	}
+	if inst := expanded[0]; inst.Calendar != "Me" || inst.End.Sub(inst.Start) != 15*time.Minute {
+		t.Errorf("instance in %q lasting %v, want in Me lasting 15m", inst.Calendar, inst.End.Sub(inst.Start))
+	}
+
+	// A format that can say the recurrence gets the series whole.
+	whole, err := expandSeries([]*agendaEvent{series}, func(*agendaEvent) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(whole) != 1 || whole[0] != series {
+		t.Errorf("got %d events, want the series alone", len(whole))
+	}
+}
+
+func TestExpandSeriesStrict(t *testing.T) {
+	bad := &agendaEvent{Event: &calendar.Event{
+		Id:         "bad",
+		Start:      &calendar.EventDateTime{DateTime: "2025-03-03T10:00:00-05:00"},
+		End:        &calendar.EventDateTime{DateTime: "2025-03-03T11:00:00-05:00"},
+		Recurrence: []string{"RRULE:FREQ=HOURLY"},
+	}}
+	never := func(*agendaEvent) bool { return false }
+	expanded, err := expandSeries([]*agendaEvent{bad}, never)
+	if err != nil || len(expanded) != 0 {
+		t.Errorf("got %d events and %v, want the event skipped", len(expanded), err)
+	}
+	strict = true
+	t.Cleanup(func() { strict = false })
+	if _, err := expandSeries([]*agendaEvent{bad}, never); err == nil {
+		t.Error("got no error with -strict")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+var relative bool
+
+func init() {
+	flag.BoolVar(&relative, "relative", false, "Show how far away each event is, as in \"in 2h\" or \"tomorrow\" (agenda and markdown formats)")
+}
+
+// relativeTime describes when t is as seen from now: in minutes or
+// hours when it is close, otherwise in days.
+func relativeTime(now, t time.Time, allday bool) string {
+	local := now.In(t.Location())
+	days := int(time.Date(t.Year(), t.Month(), t.Day(), 12, 0, 0, 0, time.UTC).Sub(
+		time.Date(local.Year(), local.Month(), local.Day(), 12, 0, 0, 0, time.UTC)) / (24 * time.Hour))
+	d := t.Sub(now)
+	if !allday && (days == 0 || d > -12*time.Hour && d < 12*time.Hour) {
+		ago := d < 0
+		if ago {
+			d = -d
+		}
+		var amount string
+		switch {
+		case d < time.Minute:
+			return "now"
+		case d < time.Hour:
+			amount = fmt.Sprintf("%dm", int(d/time.Minute))
+		default:
+			amount = fmt.Sprintf("%dh", int((d+30*time.Minute)/time.Hour))
+		}
+		if ago {
+			return amount + " ago"
+		}
+		return "in " + amount
+	}
+	switch {
+	case days == 0:
+		return "today"
+	case days == 1:
+		return "tomorrow"
+	case days == -1:
+		return "yesterday"
+	case days < 0:
+		return fmt.Sprintf("%d days ago", -days)
+	}
+	return fmt.Sprintf("in %d days", days)
+}
+
+// relativeNote is the " (in 2h)" to put after an event with -relative.
+func relativeNote(now time.Time, ev *agendaEvent) string {
+	if !relative {
+		return ""
+	}
+	return " (" + relativeTime(now, ev.Start, ev.AllDay || ev.Task) + ")"
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"time"
+)
+
+var (
+	remindClock  int
+	remindWeekly string
+	remindDate   string
+)
+
+func init() {
+	flag.IntVar(&remindClock, "remind-clock", 12, "Clock of the times in remind messages (12|24)")
+	flag.StringVar(&remindWeekly, "remind-weekly", "weekday", "How remind says a weekly event with -no-expand: by its weekday, or by repeating every 7 days (weekday|repeat)")
+	flag.StringVar(&remindDate, "remind-date", "short", "Format of the dates in remind triggers: Jan 02, Jan 02 2006 or 2006-01-02 (short|full|iso)")
+}
+
+// remindDateLayouts are the layouts of the -remind-date formats.
+var remindDateLayouts = map[string]string{
+	"short": "Jan 02",
+	"full":  "Jan 02 2006",
+	"iso":   "2006-01-02",
+}
+
+func checkRemind() error {
+	if remindClock != 12 && remindClock != 24 {
+		return usageError("-remind-clock must be 12 or 24, not %d", remindClock)
+	}
+	if remindWeekly != "weekday" && remindWeekly != "repeat" {
+		return usageError("-remind-weekly must be weekday or repeat, not %s", remindWeekly)
+	}
+	if _, ok := remindDateLayouts[remindDate]; !ok {
+		return usageError("-remind-date must be short, full or iso, not %s", remindDate)
+	}
+	return nil
+}
+
+// remindTrigger is the date that triggers a one-off reminder.
+func remindTrigger(t time.Time) string {
+	return t.Format(remindDateLayouts[remindDate])
+}
+
+// remindFullDate is a date with its year, as FROM, UNTIL and OMIT take:
+// in the -remind-date format, or ISO if that has no year.
+func remindFullDate(t time.Time) string {
+	if remindDate == "short" {
+		return t.Format("2006-01-02")
+	}
+	return remindTrigger(t)
+}
+
+// remindAt is the substitution for the time of the event in a reminder's
+// message: remind's %2 is "at 2:00pm", and %3 "at 14:00".
+func remindAt() string {
+	if remindClock == 24 {
+		return "%3"
+	}
+	return "%2"
+}
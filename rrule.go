@@ -0,0 +1,317 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// weekdayNum is a BYDAY entry, e.g. -1FR for the last Friday; n is 0 for
+// every such weekday.
+type weekdayNum struct {
+	n  int
+	wd time.Weekday
+}
+
+// rrule is the subset of RFC 5545 recurrence rules we know how to expand,
+// which covers what calendar applications actually produce.
+type rrule struct {
+	freq       string
+	interval   int
+	count      int
+	until      time.Time
+	byday      []weekdayNum
+	bymonthday []int
+	bymonth    []time.Month
+}
+
+var icsWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// parseRRule parses the value of an RRULE, e.g. FREQ=WEEKLY;BYDAY=MO,WE.
+func parseRRule(s string, localzone *time.Location) (*rrule, error) {
+	r := &rrule{interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("bad RRULE part %q", part)
+		}
+		var err error
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			r.freq = strings.ToUpper(value)
+		case "INTERVAL":
+			r.interval, err = strconv.Atoi(value)
+		case "COUNT":
+			r.count, err = strconv.Atoi(value)
+		case "UNTIL":
+			r.until, _, err = icsTime(&icsProperty{Value: value}, localzone)
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				wd, ok := icsWeekdays[strings.ToUpper(day[max(len(day)-2, 0):])]
+				if !ok {
+					return nil, fmt.Errorf("bad BYDAY %q", day)
+				}
+				n := 0
+				if len(day) > 2 {
+					if n, err = strconv.Atoi(day[:len(day)-2]); err != nil {
+						return nil, fmt.Errorf("bad BYDAY %q", day)
+					}
+				}
+				r.byday = append(r.byday, weekdayNum{n, wd})
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				d, err := strconv.Atoi(day)
+				if err != nil {
+					return nil, fmt.Errorf("bad BYMONTHDAY %q", day)
+				}
+				r.bymonthday = append(r.bymonthday, d)
+			}
+		case "BYMONTH":
+			for _, month := range strings.Split(value, ",") {
+				m, err := strconv.Atoi(month)
+				if err != nil {
+					return nil, fmt.Errorf("bad BYMONTH %q", month)
+				}
+				r.bymonth = append(r.bymonth, time.Month(m))
+			}
+		case "WKST", "BYSETPOS", "BYHOUR", "BYMINUTE", "BYSECOND", "BYYEARDAY", "BYWEEKNO":
+			// Not worth the trouble; the instances may be off.
+			log.Debugf("ignoring RRULE part %s", part)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad RRULE part %q: %w", part, err)
+		}
+	}
+	if r.interval < 1 {
+		r.interval = 1
+	}
+	switch r.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return nil, fmt.Errorf("unsupported RRULE frequency %q", r.freq)
+	}
+	return r, nil
+}
+
+// monthDays returns the days of the month matching the rule, or just
+// the day of dtstart when the rule doesn't say.
+func (r *rrule) monthDays(year int, month time.Month, dtstart time.Time) []int {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	days := make([]int, 0)
+	for _, d := range r.bymonthday {
+		if d < 0 {
+			d = last + d + 1
+		}
+		if d >= 1 && d <= last {
+			days = append(days, d)
+		}
+	}
+	for _, bd := range r.byday {
+		matches := make([]int, 0)
+		for d := 1; d <= last; d++ {
+			if time.Date(year, month, d, 0, 0, 0, 0, time.UTC).Weekday() == bd.wd {
+				matches = append(matches, d)
+			}
+		}
+		switch {
+		case bd.n == 0:
+			days = append(days, matches...)
+		case bd.n > 0 && bd.n <= len(matches):
+			days = append(days, matches[bd.n-1])
+		case bd.n < 0 && -bd.n <= len(matches):
+			days = append(days, matches[len(matches)+bd.n])
+		}
+	}
+	if len(r.bymonthday) == 0 && len(r.byday) == 0 && dtstart.Day() <= last {
+		days = append(days, dtstart.Day())
+	}
+	sort.Ints(days)
+	return days
+}
+
+// candidates returns the instances in the k'th period of the rule.
+func (r *rrule) candidates(dtstart time.Time, k int) []time.Time {
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, dtstart.Hour(), dtstart.Minute(), dtstart.Second(), 0, dtstart.Location())
+	}
+	times := make([]time.Time, 0)
+	switch r.freq {
+	case "DAILY":
+		t := dtstart.AddDate(0, 0, k*r.interval)
+		if r.matchMonth(t.Month()) && r.matchWeekday(t.Weekday()) {
+			times = append(times, t)
+		}
+	case "WEEKLY":
+		if len(r.byday) == 0 {
+			return append(times, dtstart.AddDate(0, 0, 7*k*r.interval))
+		}
+		// Weeks start on Monday.
+		monday := dtstart.AddDate(0, 0, -((int(dtstart.Weekday())+6)%7)+7*k*r.interval)
+		for _, bd := range r.byday {
+			t := monday.AddDate(0, 0, (int(bd.wd)+6)%7)
+			if r.matchMonth(t.Month()) {
+				times = append(times, t)
+			}
+		}
+	case "MONTHLY":
+		first := time.Date(dtstart.Year(), dtstart.Month()+time.Month(k*r.interval), 1, 0, 0, 0, 0, time.UTC)
+		if r.matchMonth(first.Month()) {
+			for _, d := range r.monthDays(first.Year(), first.Month(), dtstart) {
+				times = append(times, at(first.Year(), first.Month(), d))
+			}
+		}
+	case "YEARLY":
+		year := dtstart.Year() + k*r.interval
+		months := r.bymonth
+		if len(months) == 0 {
+			months = []time.Month{dtstart.Month()}
+		}
+		for _, m := range months {
+			for _, d := range r.monthDays(year, m, dtstart) {
+				times = append(times, at(year, m, d))
+			}
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times
+}
+
+func (r *rrule) matchMonth(m time.Month) bool {
+	if len(r.bymonth) == 0 {
+		return true
+	}
+	for _, bm := range r.bymonth {
+		if bm == m {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rrule) matchWeekday(wd time.Weekday) bool {
+	if len(r.byday) == 0 {
+		return true
+	}
+	for _, bd := range r.byday {
+		if bd.wd == wd {
+			return true
+		}
+	}
+	return false
+}
+
+// occurrences returns the start of every instance before end, starting
+// with dtstart itself.
+func (r *rrule) occurrences(dtstart, end time.Time) []time.Time {
+	// Enough for a daily event over 25 years; anything beyond that is
+	// more likely a rule we misunderstood.
+	const maxPeriods = 10000
+	times := make([]time.Time, 0)
+	for k := 0; k < maxPeriods; k++ {
+		for _, t := range r.candidates(dtstart, k) {
+			if t.Before(dtstart) {
+				continue
+			}
+			if !t.Before(end) || (!r.until.IsZero() && t.After(r.until)) ||
+				(r.count > 0 && len(times) >= r.count) {
+				return times
+			}
+			times = append(times, t)
+		}
+	}
+	return times
+}
+
+// instanceID is the id we give an instance of a recurring event, the same
+// way icsEvent does for overridden instances.
+func instanceID(uid string, t time.Time) string {
+	return uid + "_" + t.UTC().Format("20060102T150405Z")
+}
+
+// expandRecurrence turns an event with RRULE/RDATE/EXDATE recurrence
+// lines into its instances starting before end.
+func expandRecurrence(ev *calendar.Event, end time.Time, localzone *time.Location) ([]*calendar.Event, error) {
+	dtstart, allday, err := parseEventTime(ev.Start)
+	if err != nil {
+		return nil, err
+	}
+	dtend, _, err := parseEventTime(ev.End)
+	if err != nil {
+		return nil, err
+	}
+	length := dtend.Sub(dtstart)
+	days := int(length.Hours() / 24)
+	if allday {
+		// Dates are parsed as midnight UTC; recur in our own zone.
+		dtstart = time.Date(dtstart.Year(), dtstart.Month(), dtstart.Day(), 0, 0, 0, 0, localzone)
+	} else if ev.Start.TimeZone != "" {
+		// Recur in the event's zone, so that it stays put across DST
+		// changes.
+		if loc, err := time.LoadLocation(ev.Start.TimeZone); err == nil {
+			dtstart = dtstart.In(loc)
+		}
+	}
+
+	starts := make([]time.Time, 0)
+	exdates := map[int64]bool{}
+	hasRule := false
+	for _, line := range ev.Recurrence {
+		p, err := parseICSLine(line)
+		if err != nil {
+			return nil, err
+		}
+		switch p.Name {
+		case "RRULE":
+			r, err := parseRRule(p.Value, localzone)
+			if err != nil {
+				return nil, err
+			}
+			starts = append(starts, r.occurrences(dtstart, end)...)
+			hasRule = true
+		case "RDATE", "EXDATE":
+			for _, value := range strings.Split(p.Value, ",") {
+				t, _, err := icsTime(&icsProperty{Name: p.Name, Params: p.Params, Value: value}, localzone)
+				if err != nil {
+					return nil, fmt.Errorf("bad %s: %w", p.Name, err)
+				}
+				if p.Name == "RDATE" {
+					starts = append(starts, t)
+				} else {
+					exdates[t.Unix()] = true
+				}
+			}
+		}
+	}
+	if !hasRule {
+		starts = append(starts, dtstart)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+
+	instances := make([]*calendar.Event, 0, len(starts))
+	for _, t := range starts {
+		if exdates[t.Unix()] {
+			continue
+		}
+		inst := *ev
+		inst.Id = instanceID(ev.Id, t)
+		inst.RecurringEventId = ev.Id
+		inst.Recurrence = nil
+		inst.Start = eventDateTime(t, allday)
+		inst.OriginalStartTime = inst.Start
+		if allday {
+			inst.End = eventDateTime(t.AddDate(0, 0, days), true)
+		} else {
+			inst.End = eventDateTime(t.Add(length), false)
+		}
+		instances = append(instances, &inst)
+	}
+	return instances, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestParseRRuleErrors(t *testing.T) {
+	loc := testNow(t).Location()
+	for _, rule := range []string{
+		"FREQ=HOURLY",
+		"FREQ",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=WEEKLY;BYDAY=aMO",
+		"FREQ=MONTHLY;BYMONTHDAY=last",
+		"FREQ=YEARLY;BYMONTH=jan",
+		"FREQ=DAILY;COUNT=ten",
+		"FREQ=DAILY;UNTIL=tomorrow",
+	} {
+		if r, err := parseRRule(rule, loc); err == nil {
+			t.Errorf("parseRRule(%q) = %+v, want an error", rule, r)
+		}
+	}
+}
+
+// instanceStarts are the starts of the instances of an event, as they
+// come out of expandRecurrence.
+func instanceStarts(instances []*calendar.Event) string {
+	starts := make([]string, 0, len(instances))
+	for _, inst := range instances {
+		if inst.Start.Date != "" {
+			starts = append(starts, inst.Start.Date)
+		} else {
+			starts = append(starts, inst.Start.DateTime)
+		}
+	}
+	return strings.Join(starts, " ")
+}
+
+func TestExpandRecurrence(t *testing.T) {
+	localzone := testNow(t).Location()
+	end := time.Date(2026, 1, 1, 0, 0, 0, 0, localzone)
+	timed := func(start, end string, recurrence ...string) *calendar.Event {
+		return &calendar.Event{
+			Id:         "ev",
+			Start:      &calendar.EventDateTime{DateTime: start, TimeZone: "America/Montreal"},
+			End:        &calendar.EventDateTime{DateTime: end, TimeZone: "America/Montreal"},
+			Recurrence: recurrence,
+		}
+	}
+	tests := []struct {
+		name string
+		ev   *calendar.Event
+		want string
+	}{{
+		// The instances stay at 10:00 across the change to daylight
+		// saving time on March 9.
+		"weekly by day",
+		timed("2025-03-03T10:00:00-05:00", "2025-03-03T10:30:00-05:00", "RRULE:FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4"),
+		"2025-03-03T10:00:00-05:00 2025-03-05T10:00:00-05:00 2025-03-10T10:00:00-04:00 2025-03-12T10:00:00-04:00",
+	}, {
+		"every other day, with exceptions and extras",
+		timed("2025-03-03T10:00:00-05:00", "2025-03-03T11:00:00-05:00",
+			"RRULE:FREQ=DAILY;INTERVAL=2;UNTIL=20250309T235959Z",
+			"EXDATE;TZID=America/Montreal:20250305T100000",
+			"RDATE;TZID=America/Montreal:20250304T150000"),
+		"2025-03-03T10:00:00-05:00 2025-03-04T15:00:00-05:00 2025-03-07T10:00:00-05:00 2025-03-09T10:00:00-04:00",
+	}, {
+		"last Friday of the month",
+		timed("2025-03-28T16:00:00-04:00", "2025-03-28T17:00:00-04:00", "RRULE:FREQ=MONTHLY;BYDAY=-1FR;COUNT=3"),
+		"2025-03-28T16:00:00-04:00 2025-04-25T16:00:00-04:00 2025-05-30T16:00:00-04:00",
+	}, {
+		// Months without a 31st are skipped.
+		"monthly on the 31st",
+		timed("2025-01-31T09:00:00-05:00", "2025-01-31T09:15:00-05:00", "RRULE:FREQ=MONTHLY;COUNT=3"),
+		"2025-01-31T09:00:00-05:00 2025-03-31T09:00:00-04:00 2025-05-31T09:00:00-04:00",
+	}, {
+		"yearly all day",
+		&calendar.Event{
+			Id:         "birthday",
+			Start:      &calendar.EventDateTime{Date: "2023-03-05"},
+			End:        &calendar.EventDateTime{Date: "2023-03-06"},
+			Recurrence: []string{"RRULE:FREQ=YEARLY"},
+		},
+		"2023-03-05 2024-03-05 2025-03-05",
+	}, {
+		"no rule",
+		timed("2025-03-03T10:00:00-05:00", "2025-03-03T10:30:00-05:00", "RDATE;TZID=America/Montreal:20250310T100000"),
+		"2025-03-03T10:00:00-05:00 2025-03-10T10:00:00-04:00",
+	}}
+	for _, tt := range tests {
+		instances, err := expandRecurrence(tt.ev, end, localzone)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := instanceStarts(instances); got != tt.want {
+			t.Errorf("%s: got instances\n\t%s\nwant\n\t%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExpandRecurrenceInstances(t *testing.T) {
+	localzone := testNow(t).Location()
+	ev := &calendar.Event{
+		Id:         "offsite",
+		Summary:    "Offsite",
+		Start:      &calendar.EventDateTime{Date: "2025-03-06"},
+		End:        &calendar.EventDateTime{Date: "2025-03-08"},
+		Recurrence: []string{"RRULE:FREQ=WEEKLY;COUNT=2"},
+	}
+	instances, err := expandRecurrence(ev, time.Date(2026, 1, 1, 0, 0, 0, 0, localzone), localzone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 2 {
+		t.Fatalf("got %d instances, want 2", len(instances))
+	}
+	inst := instances[1]
+	if inst.Id != "offsite_20250313T040000Z" || inst.RecurringEventId != "offsite" {
+		t.Errorf("got id %q of %q, want offsite_20250313T040000Z of offsite", inst.Id, inst.RecurringEventId)
+	}
+	if inst.Start.Date != "2025-03-13" || inst.End.Date != "2025-03-15" {
+		t.Errorf("got %s to %s, want the two days from 2025-03-13", inst.Start.Date, inst.End.Date)
+	}
+	if inst.Recurrence != nil || inst.Summary != "Offsite" {
+		t.Errorf("got recurrence %v and summary %q, want none and Offsite", inst.Recurrence, inst.Summary)
+	}
+}
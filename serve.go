@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	serveListen  string
+	serveRefresh time.Duration
+)
+
+func init() {
+	register(&command{
+		name:    "serve",
+		summary: "Serve the agenda over HTTP",
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&serveListen, "listen", "localhost:8080", "Address to listen on (the agenda is served without authentication)")
+			fs.DurationVar(&serveRefresh, "refresh", 5*time.Minute, "How long to keep events before fetching them again")
+		},
+		run: runServe,
+	})
+}
+
+// eventCache keeps the events of each window for a while, so that
+// clients polling the server don't each cost a round of API calls.
+type eventCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*cacheEntry
+	metrics serverMetrics
+}
+
+type cacheEntry struct {
+	fetched time.Time
+	events  []*agendaEvent
+}
+
+// Clients choose the window, so there are limits to how long it can be
+// and to how many windows we keep.
+const (
+	maxServeWindow  = 366 * 24 * time.Hour
+	maxCacheEntries = 16
+)
+
+// evict makes room for a new entry: it drops the stale entries, and the
+// oldest one if that isn't enough. The caller holds c.mu.
+func (c *eventCache) evict() {
+	var oldest string
+	for dur, e := range c.entries {
+		if time.Since(e.fetched) >= c.ttl {
+			delete(c.entries, dur)
+			continue
+		}
+		if oldest == "" || e.fetched.Before(c.entries[oldest].fetched) {
+			oldest = dur
+		}
+	}
+	if len(c.entries) >= maxCacheEntries {
+		delete(c.entries, oldest)
+	}
+}
+
+// get returns the events for a duration, fetching them if we don't have
+// them or they are stale. Only one fetch runs at a time, and it's shared
+// by everyone waiting, so it doesn't stop when the request that started
+// it goes away.
+func (c *eventCache) get(ctx context.Context, dur string) ([]*agendaEvent, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[dur]; ok && time.Since(e.fetched) < c.ttl {
+		return e.events, nil
+	}
+	localzone, err := localZone()
+	if err != nil {
+		return nil, err
+	}
+	events, _, err := agendaEvents(context.WithoutCancel(ctx), dur, localzone)
+	c.metrics.fetched(err)
+	if err != nil {
+		return nil, err
+	}
+	c.evict()
+	c.entries[dur] = &cacheEntry{time.Now(), events}
+	return events, nil
+}
+
+var contentTypes = map[string]string{
+	"json": "application/json",
+	"ics":  "text/calendar; charset=utf-8",
+	"html": "text/html; charset=utf-8",
+}
+
+type server struct {
+	cache *eventCache
+}
+
+// events answers with the events of the duration in the request, or
+// the -duration one.
+func (s *server) events(w http.ResponseWriter, r *http.Request) ([]*agendaEvent, bool) {
+	dur := r.URL.Query().Get("duration")
+	if dur == "" {
+		dur = duration
+	}
+	start, end, err := window(time.Now(), dur)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if end.Sub(start) > maxServeWindow {
+		http.Error(w, "duration too long: the most is a year", http.StatusBadRequest)
+		return nil, false
+	}
+	events, err := s.cache.get(r.Context(), dur)
+	if err != nil {
+		log.Errorf("%s: %v", r.URL, err)
+		http.Error(w, "unable to read the calendars", http.StatusBadGateway)
+		return nil, false
+	}
+	return events, true
+}
+
+func (s *server) handleAgenda(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("format")
+	if name == "" {
+		name = "json"
+	}
+	formatter, ok := formatters[name]
+	// Taskwarrior UUIDs are only kept by the agenda, which saves them.
+	if !ok || name == "taskwarrior" {
+		http.Error(w, "unsupported format: "+name, http.StatusBadRequest)
+		return
+	}
+	events, ok := s.events(w, r)
+	if !ok {
+		return
+	}
+	var buf bytes.Buffer
+	if err := formatter(&buf, events); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctype, ok := contentTypes[name]
+	if !ok {
+		ctype = "text/plain; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Write(buf.Bytes())
+}
+
+// handleNext answers with the next timed event that hasn't ended yet, or
+// 204 No Content if there is none in the window.
+func (s *server) handleNext(w http.ResponseWriter, r *http.Request) {
+	events, ok := s.events(w, r)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	for _, ev := range sortedByStart(events) {
+		if ev.AllDay || ev.Task || !ev.End.After(now) {
+			continue
+		}
+		writeJSON(w, newJSONEvent(ev))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleFreeBusy answers with the times we are busy, without saying
+// with what.
+func (s *server) handleFreeBusy(w http.ResponseWriter, r *http.Request) {
+	events, ok := s.events(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, busyIntervals(events))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Warningf("unable to write response: %v", err)
+	}
+}
+
+// get only lets GET and HEAD requests through, since we are read-only.
+func get(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		log.Infof("%s %s", r.Method, r.URL)
+		h(w, r)
+	}
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/agenda", get(s.handleAgenda))
+	mux.HandleFunc("/next", get(s.handleNext))
+	mux.HandleFunc("/freebusy", get(s.handleFreeBusy))
+	mux.HandleFunc("/metrics", get(s.handleMetrics))
+	return mux
+}
+
+func runServe(args []string) error {
+	sharedOutput = true
+	if _, err := parseFilters(); err != nil {
+		return err
+	}
+	if err := loadAlsoZones(); err != nil {
+		return err
+	}
+	if withTasks && prof.Provider != "google" {
+		return usageError("tasks are only available from Google")
+	}
+	s := &server{cache: &eventCache{ttl: serveRefresh, entries: map[string]*cacheEntry{}}}
+	// Authorize now, while there is a terminal to do it from, rather
+	// than on the first request.
+	if _, err := s.cache.get(context.Background(), duration); err != nil {
+		return err
+	}
+	go keepTokenFresh(context.Background(), time.Minute)
+	log.Infof("listening on %s", serveListen)
+	srv := &http.Server{
+		Addr:              serveListen,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if err := srv.ListenAndServe(); err != nil {
+		return usageError("unable to serve: %v", err)
+	}
+	return nil
+}
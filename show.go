@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var showJSON bool
+
+func init() {
+	register(&command{
+		name:    "show",
+		args:    "event-id|search-term",
+		summary: "Print everything about one event in the window",
+		flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&showJSON, "json", false, "Print the event as JSON")
+		},
+		run: runShow,
+	})
+}
+
+// findEvents returns the event whose id is query, or failing that the
+// events whose summary contains it. The id may be our own, as in the
+// json and org output, the provider's, or the iCalendar UID.
+func findEvents(events []*agendaEvent, query string) []*agendaEvent {
+	for _, ev := range events {
+		if query == ev.StableID() || query == ev.Id {
+			return []*agendaEvent{ev}
+		}
+	}
+	found := make([]*agendaEvent, 0)
+	for _, ev := range sortedByStart(events) {
+		if ev.ICalUID == query || strings.Contains(strings.ToLower(summary(ev)), strings.ToLower(query)) {
+			found = append(found, ev)
+		}
+	}
+	return found
+}
+
+// findEvent is findEvents for the commands that work on a single event.
+// It lists the candidates when the query matches several.
+func findEvent(ctx context.Context, query string) (*agendaEvent, error) {
+	localzone, err := localZone()
+	if err != nil {
+		return nil, err
+	}
+	events, _, err := agendaEvents(ctx, duration, localzone)
+	if err != nil {
+		return nil, err
+	}
+	found := findEvents(events, query)
+	switch len(found) {
+	case 0:
+		return nil, usageError("no event matching %q in the window; try a longer -duration", query)
+	case 1:
+		return found[0], nil
+	}
+	if ev := nextInSeries(time.Now(), found); ev != nil {
+		return ev, nil
+	}
+	for _, ev := range found {
+		fmt.Fprintf(os.Stderr, "%s  %s  %s\n", ev.StableID(), eventWhen(ev), summary(ev))
+	}
+	return nil, usageError("%d events match %q; give one of the ids above", len(found), query)
+}
+
+// nextInSeries is the next of the events if they are all instances of
+// the same recurring event, and nil otherwise.
+func nextInSeries(now time.Time, events []*agendaEvent) *agendaEvent {
+	first := events[0]
+	for _, ev := range events {
+		if ev.RecurringEventId == "" || ev.RecurringEventId != first.RecurringEventId || ev.CalendarID != first.CalendarID {
+			return nil
+		}
+	}
+	for _, ev := range events {
+		if ev.End.After(now) {
+			return ev
+		}
+	}
+	return events[len(events)-1]
+}
+
+// fillRecurrence looks up the rule of the series an instance of a
+// recurring event belongs to, where the provider can.
+func fillRecurrence(ctx context.Context, ev *agendaEvent) {
+	if len(ev.Recurrence) > 0 || ev.RecurringEventId == "" {
+		return
+	}
+	g, ok := ev.Provider.(eventGetter)
+	if !ok {
+		return
+	}
+	series, err := g.Event(ctx, ev.CalendarID, ev.RecurringEventId)
+	if err != nil {
+		log.Warningf("unable to look up the recurrence: %v", err)
+		return
+	}
+	// Keep the instance's own event intact for the other commands.
+	copied := *ev.Event
+	copied.Recurrence = series.Recurrence
+	ev.Event = &copied
+}
+
+type jsonAttendee struct {
+	Name      string `json:"name,omitempty"`
+	Email     string `json:"email,omitempty"`
+	Response  string `json:"response,omitempty"`
+	Optional  bool   `json:"optional,omitempty"`
+	Organizer bool   `json:"organizer,omitempty"`
+	Self      bool   `json:"self,omitempty"`
+}
+
+type jsonAttachment struct {
+	Title    string `json:"title"`
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type,omitempty"`
+	FileID   string `json:"file_id,omitempty"`
+}
+
+type jsonEntryPoint struct {
+	Type  string `json:"type"`
+	URI   string `json:"uri"`
+	Label string `json:"label,omitempty"`
+	Pin   string `json:"pin,omitempty"`
+}
+
+// jsonDetails is how show -json has events: the json format's fields
+// and everything else we know.
+type jsonDetails struct {
+	*jsonEvent
+	EventID     string            `json:"event_id"`
+	Join        string            `json:"join,omitempty"`
+	Organizer   *jsonAttendee     `json:"organizer,omitempty"`
+	Attendees   []*jsonAttendee   `json:"attendees"`
+	Attachments []*jsonAttachment `json:"attachments"`
+	Conference  []*jsonEntryPoint `json:"conference"`
+	Recurrence  []string          `json:"recurrence,omitempty"`
+	Updated     *time.Time        `json:"updated,omitempty"`
+}
+
+func newJSONDetails(ev *agendaEvent) *jsonDetails {
+	d := &jsonDetails{
+		jsonEvent:   newJSONEvent(ev),
+		EventID:     ev.Id,
+		Join:        meetingLink(ev),
+		Attendees:   make([]*jsonAttendee, 0, len(ev.Attendees)),
+		Attachments: make([]*jsonAttachment, 0, len(ev.Attachments)),
+		Conference:  make([]*jsonEntryPoint, 0),
+		Recurrence:  ev.Recurrence,
+	}
+	if ev.Organizer != nil {
+		d.Organizer = &jsonAttendee{Name: ev.Organizer.DisplayName, Email: ev.Organizer.Email, Self: ev.Organizer.Self}
+	}
+	for _, att := range ev.Attendees {
+		d.Attendees = append(d.Attendees, &jsonAttendee{att.DisplayName, att.Email, att.ResponseStatus,
+			att.Optional, att.Organizer, att.Self})
+	}
+	for _, a := range ev.Attachments {
+		d.Attachments = append(d.Attachments, &jsonAttachment{a.Title, a.FileUrl, a.MimeType, a.FileId})
+	}
+	if ev.ConferenceData != nil {
+		for _, ep := range ev.ConferenceData.EntryPoints {
+			d.Conference = append(d.Conference, &jsonEntryPoint{ep.EntryPointType, ep.Uri, ep.Label, ep.Pin})
+		}
+	}
+	if updated, err := time.Parse(time.RFC3339, ev.Updated); err == nil {
+		d.Updated = &updated
+	}
+	return d
+}
+
+func runShow(args []string) error {
+	if len(args) != 1 {
+		return usageError("usage: gcal show event-id|search-term")
+	}
+	if _, err := parseFilters(); err != nil {
+		return err
+	}
+	if err := loadAlsoZones(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	ev, err := findEvent(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	fillRecurrence(ctx, ev)
+	if showJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(newJSONDetails(ev))
+	}
+	eventDetails(os.Stdout, ev)
+	fmt.Printf("\nID:        %s\n", ev.StableID())
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// Kinds of special calendars, whose all-day entries are not meetings and
+// are shown differently.
+const (
+	kindBirthday = "birthday"
+	kindHoliday  = "holiday"
+)
+
+var (
+	noBirthdays bool
+	noHolidays  bool
+)
+
+func init() {
+	flag.BoolVar(&noBirthdays, "no-birthdays", false, "Skip birthday calendars and events")
+	flag.BoolVar(&noHolidays, "no-holidays", false, "Skip holiday calendars")
+}
+
+// calendarKind tells Google's contact birthday and public holiday
+// calendars from the others by their ids, such as
+// addressbook#contacts@group.v.calendar.google.com and
+// en.canadian#holiday@group.v.calendar.google.com. The kind setting
+// overrides that.
+func calendarKind(item *calendar.CalendarListEntry) string {
+	if kind := calendarSettings(item).Kind; kind != "" {
+		return kind
+	}
+	switch {
+	case strings.HasSuffix(item.Id, "#contacts@group.v.calendar.google.com"):
+		return kindBirthday
+	case strings.HasSuffix(item.Id, "#holiday@group.v.calendar.google.com"):
+		return kindHoliday
+	}
+	return ""
+}
+
+// eventKind is the kind of an event, which is that of its calendar,
+// except that birthdays can also turn up in ordinary calendars.
+func eventKind(item *calendar.CalendarListEntry, ev *calendar.Event) string {
+	if ev.EventType == "birthday" {
+		return kindBirthday
+	}
+	return calendarKind(item)
+}
+
+// skipKind reports whether events of this kind were asked to be left
+// out.
+func skipKind(kind string) bool {
+	return kind == kindBirthday && noBirthdays || kind == kindHoliday && noHolidays
+}
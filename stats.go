@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+var statsJSON bool
+
+func init() {
+	register(&command{
+		name:    "stats",
+		summary: "Print how much of the window is taken by meetings",
+		flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&statsJSON, "json", false, "Print the statistics as JSON")
+		},
+		run: runStats,
+	})
+}
+
+// dayStats is the meeting load of one day.
+type dayStats struct {
+	Date     string  `json:"date"`
+	Meetings int     `json:"meetings"`
+	Hours    float64 `json:"hours"`
+}
+
+// calendarStats is the meeting load from one calendar.
+type calendarStats struct {
+	Calendar string  `json:"calendar"`
+	Meetings int     `json:"meetings"`
+	Hours    float64 `json:"hours"`
+}
+
+// streak is a run of meetings with no break between them.
+type streak struct {
+	Meetings int       `json:"meetings"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Hours    float64   `json:"hours"`
+}
+
+type meetingStats struct {
+	Meetings int     `json:"meetings"`
+	Hours    float64 `json:"hours"`
+	// BusiestDay is nil when there are no meetings.
+	BusiestDay *dayStats `json:"busiest_day"`
+	// BackToBack counts the streaks of two meetings or more, and
+	// LongestStreak is nil when there are none.
+	BackToBack    int             `json:"back_to_back"`
+	LongestStreak *streak         `json:"longest_streak"`
+	Days          []dayStats      `json:"days"`
+	Calendars     []calendarStats `json:"calendars"`
+}
+
+// isMeeting reports whether an event takes up time: a timed event that
+// we have not declined and that does not leave us free.
+func isMeeting(ev *agendaEvent) bool {
+	if ev.AllDay || ev.Task || ev.Transparency == "transparent" {
+		return false
+	}
+	for _, att := range ev.Attendees {
+		if att.Self && att.ResponseStatus == "declined" {
+			return false
+		}
+	}
+	return true
+}
+
+func hours(d time.Duration) float64 {
+	return float64(d.Round(time.Minute)) / float64(time.Hour)
+}
+
+// computeStats works out the meeting load. Overlapping meetings are only
+// counted once in the hours of the whole window and of each day, but
+// in full in each calendar's.
+func computeStats(events []*agendaEvent) *meetingStats {
+	meetings := make([]*agendaEvent, 0, len(events))
+	for _, ev := range events {
+		// Travel time takes up the day, but isn't a meeting.
+		if isMeeting(ev) && !ev.Buffer {
+			meetings = append(meetings, ev)
+		}
+	}
+	sort.SliceStable(meetings, func(i, j int) bool {
+		return meetings[i].Start.Before(meetings[j].Start)
+	})
+
+	stats := &meetingStats{
+		Meetings:  len(meetings),
+		Days:      make([]dayStats, 0),
+		Calendars: make([]calendarStats, 0),
+	}
+	days := map[string]*dayStats{}
+	calendars := map[string]*calendarStats{}
+	var total time.Duration
+	var current *streak
+	var busyUntil time.Time
+	for _, ev := range meetings {
+		date := ev.Start.Format("2006-01-02")
+		day, ok := days[date]
+		if !ok {
+			day = &dayStats{Date: date}
+			days[date] = day
+		}
+		day.Meetings++
+		cal, ok := calendars[ev.Calendar]
+		if !ok {
+			cal = &calendarStats{Calendar: ev.Calendar}
+			calendars[ev.Calendar] = cal
+		}
+		cal.Meetings++
+		cal.Hours += hours(ev.End.Sub(ev.Start))
+
+		// Only count the part of the meeting we weren't already busy for.
+		from := ev.Start
+		if busyUntil.After(from) {
+			from = busyUntil
+		}
+		if ev.End.After(from) {
+			total += ev.End.Sub(from)
+			day.Hours += hours(ev.End.Sub(from))
+		}
+
+		if current != nil && !ev.Start.After(busyUntil) {
+			current.Meetings++
+			if ev.End.After(current.End) {
+				current.End = ev.End
+			}
+		} else {
+			current = &streak{Meetings: 1, Start: ev.Start, End: ev.End}
+		}
+		current.Hours = hours(current.End.Sub(current.Start))
+		if current.Meetings == 2 {
+			stats.BackToBack++
+		}
+		if stats.LongestStreak == nil || current.Meetings > stats.LongestStreak.Meetings {
+			stats.LongestStreak = current
+		}
+		if ev.End.After(busyUntil) {
+			busyUntil = ev.End
+		}
+	}
+	stats.Hours = hours(total)
+	if stats.LongestStreak != nil && stats.LongestStreak.Meetings < 2 {
+		stats.LongestStreak = nil
+	}
+
+	for _, day := range days {
+		stats.Days = append(stats.Days, *day)
+	}
+	sort.Slice(stats.Days, func(i, j int) bool { return stats.Days[i].Date < stats.Days[j].Date })
+	for i := range stats.Days {
+		if stats.BusiestDay == nil || stats.Days[i].Hours > stats.BusiestDay.Hours {
+			stats.BusiestDay = &stats.Days[i]
+		}
+	}
+	for _, cal := range calendars {
+		stats.Calendars = append(stats.Calendars, *cal)
+	}
+	sort.Slice(stats.Calendars, func(i, j int) bool {
+		a, b := stats.Calendars[i], stats.Calendars[j]
+		if a.Hours != b.Hours {
+			return a.Hours > b.Hours
+		}
+		return a.Calendar < b.Calendar
+	})
+	return stats
+}
+
+func runStats(args []string) error {
+	localzone, err := localZone()
+	if err != nil {
+		return err
+	}
+	events, _, err := agendaEvents(context.Background(), duration, localzone)
+	if err != nil {
+		return err
+	}
+	stats := computeStats(events)
+	if statsJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	}
+	printStats(stats)
+	return nil
+}
+
+func printStats(stats *meetingStats) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintf(tw, "Meetings\t%d\n", stats.Meetings)
+	fmt.Fprintf(tw, "Hours\t%.1f\n", stats.Hours)
+	if stats.BusiestDay != nil {
+		fmt.Fprintf(tw, "Busiest day\t%s (%.1fh in %d meetings)\n",
+			stats.BusiestDay.Date, stats.BusiestDay.Hours, stats.BusiestDay.Meetings)
+	}
+	fmt.Fprintf(tw, "Back-to-back streaks\t%d\n", stats.BackToBack)
+	if s := stats.LongestStreak; s != nil {
+		fmt.Fprintf(tw, "Longest streak\t%d meetings, %s %s-%s\n",
+			s.Meetings, s.Start.Format("Mon Jan 02"), s.Start.Format("15:04"), s.End.Format("15:04"))
+	}
+	if len(stats.Days) > 0 {
+		fmt.Fprintf(tw, "\nDay\tMeetings\tHours\n")
+		for _, day := range stats.Days {
+			fmt.Fprintf(tw, "%s\t%d\t%.1f\n", day.Date, day.Meetings, day.Hours)
+		}
+	}
+	if len(stats.Calendars) > 0 {
+		fmt.Fprintf(tw, "\nCalendar\tMeetings\tHours\n")
+		for _, cal := range stats.Calendars {
+			fmt.Fprintf(tw, "%s\t%d\t%.1f\n", cal.Calendar, cal.Meetings, cal.Hours)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+var colorMode string
+
+func init() {
+	formatters["table"] = formatTable
+	formatExtensions["table"] = ".txt"
+	flag.StringVar(&colorMode, "color", "auto", "Color the table format (auto|always|never)")
+}
+
+// yellow marks the invitations we haven't answered.
+const yellow = "\x1b[33m"
+
+// defaultTableWidth is the width of the table when it isn't going to a
+// terminal that tells us its size.
+const defaultTableWidth = 100
+
+// tableHeadings are the columns of the table format.
+var tableHeadings = []string{"Time", "Duration", "Calendar", "Summary", "Location"}
+
+// Columns that get narrower, in turn, to fit the table in the terminal,
+// and how narrow they may get.
+var (
+	tableShrink   = []int{4, 2, 3}
+	tableMinWidth = map[int]int{2: 10, 3: 16, 4: 12}
+)
+
+// terminalWidth is the width of the terminal w writes to, or $COLUMNS,
+// or a sensible width for a file.
+func terminalWidth(w io.Writer) int {
+	if f, ok := w.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		if width, _, err := term.GetSize(int(f.Fd())); err == nil && width > 0 {
+			return width
+		}
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return defaultTableWidth
+}
+
+// useColor tells whether to color the table: with -color auto, only on
+// a terminal and unless NO_COLOR is set.
+func useColor(w io.Writer) bool {
+	switch colorMode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// shortDuration is how long the event is, as in 45m, 1h30 or 2d.
+func shortDuration(ev *agendaEvent) string {
+	switch {
+	case ev.Task:
+		return ""
+	case ev.AllDay:
+		return fmt.Sprintf("%dd", int(math.Round(ev.End.Sub(ev.Start).Hours()/24)))
+	}
+	d := ev.End.Sub(ev.Start).Round(time.Minute)
+	h, m := int(d.Hours()), int(d.Minutes())%60
+	switch {
+	case h == 0:
+		return fmt.Sprintf("%dm", m)
+	case m == 0:
+		return fmt.Sprintf("%dh", h)
+	}
+	return fmt.Sprintf("%dh%02d", h, m)
+}
+
+// tableRow is a line of the table, with the style to write its cells in.
+type tableRow struct {
+	cells []string
+	style string
+	// newDay is set on the first row of each day, to rule a line above.
+	newDay bool
+}
+
+// formatTable writes the agenda as a table with aligned columns, sized
+// to the terminal, for reading rather than for other programs.
+func formatTable(w io.Writer, events []*agendaEvent) error {
+	now := time.Now()
+	rows := make([]*tableRow, 0, len(events))
+	hasLocation := false
+	var day time.Time
+	for i, ev := range sortedByStart(events) {
+		date := localDate(ev.Start, "Mon Jan 02")
+		newDay := i == 0 || !sameDay(ev.Start, day)
+		if newDay {
+			day = ev.Start
+		} else {
+			date = strings.Repeat(" ", utf8.RuneCountInString(date))
+		}
+		var when string
+		switch {
+		case ev.Task:
+			when = "todo"
+		case ev.AllDay:
+			when = "all day"
+		default:
+			when = ev.Start.Format("15:04")
+		}
+		location := strings.Join(strings.Fields(ev.Location), " ")
+		hasLocation = hasLocation || location != ""
+		row := &tableRow{
+			cells: []string{
+				date + "  " + when,
+				shortDuration(ev),
+				ev.Calendar,
+				markedSummary(ev) + alsoTimes(ev) + relativeNote(now, ev),
+				location,
+			},
+			newDay: newDay && i > 0,
+		}
+		switch {
+		case ev.Demoted || ev.Buffer:
+			row.style = dim
+		case responseStatus(ev) == "needsAction":
+			row.style = yellow
+		}
+		rows = append(rows, row)
+	}
+	columns := len(tableHeadings)
+	if !hasLocation {
+		columns--
+	}
+	widths := make([]int, columns)
+	for i := range widths {
+		widths[i] = utf8.RuneCountInString(tableHeadings[i])
+		for _, row := range rows {
+			widths[i] = max(widths[i], utf8.RuneCountInString(row.cells[i]))
+		}
+	}
+	// Each column takes a space on either side and a rule on its right,
+	// and the table a rule on its left.
+	excess := 1 - terminalWidth(w)
+	for _, width := range widths {
+		excess += width + 3
+	}
+	for _, i := range tableShrink {
+		if excess <= 0 {
+			break
+		}
+		if i >= columns {
+			continue
+		}
+		cut := min(excess, widths[i]-tableMinWidth[i])
+		if cut > 0 {
+			widths[i] -= cut
+			excess -= cut
+		}
+	}
+	color := useColor(w)
+	paint := func(style, s string) string {
+		if !color || style == "" {
+			return s
+		}
+		return style + s + reset
+	}
+	rule := func(left, middle, right string) {
+		parts := make([]string, columns)
+		for i, width := range widths {
+			parts[i] = strings.Repeat("─", width+2)
+		}
+		fmt.Fprintln(w, paint(dim, left+strings.Join(parts, middle)+right))
+	}
+	line := func(cells []string, style string) {
+		var b strings.Builder
+		b.WriteString(paint(dim, "│"))
+		for i, width := range widths {
+			b.WriteString(" " + paint(style, pad(cells[i], width)) + " " + paint(dim, "│"))
+		}
+		fmt.Fprintln(w, b.String())
+	}
+	rule("┌", "┬", "┐")
+	line(tableHeadings, bold)
+	rule("├", "┼", "┤")
+	for _, row := range rows {
+		if row.newDay {
+			rule("├", "┼", "┤")
+		}
+		line(row.cells, row.style)
+	}
+	rule("└", "┴", "┘")
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// A tagRule gives a tag to the events that match all of its patterns.
+// Patterns are regular expressions, matched regardless of case; one
+// that starts with ! matches what the rest of it doesn't.
+type tagRule struct {
+	Tag string `json:"tag"`
+	// Summary is matched against the event's summary.
+	Summary string `json:"summary"`
+	// Organizer is matched against the organizer's name and address.
+	Organizer string `json:"organizer"`
+	// Calendar is matched against the calendar's name and id.
+	Calendar string `json:"calendar"`
+	// Attendee is matched against each guest's name and address, and
+	// matches if one of them does.
+	Attendee string `json:"attendee"`
+
+	summary, organizer, calendar, attendee *tagPattern
+}
+
+// tagName keeps tags to what both org and remind take as a tag.
+var tagName = regexp.MustCompile(`^[A-Za-z0-9_@#%]+$`)
+
+type tagPattern struct {
+	re     *regexp.Regexp
+	negate bool
+}
+
+func compilePattern(s string) (*tagPattern, error) {
+	if s == "" {
+		return nil, nil
+	}
+	p := &tagPattern{}
+	if strings.HasPrefix(s, "!") {
+		p.negate = true
+		s = s[1:]
+	}
+	re, err := regexp.Compile("(?i)" + s)
+	if err != nil {
+		return nil, err
+	}
+	p.re = re
+	return p, nil
+}
+
+// matches tells whether one of the values matches, or with !, none.
+func (p *tagPattern) matches(values ...string) bool {
+	found := false
+	for _, v := range values {
+		if v != "" && p.re.MatchString(v) {
+			found = true
+		}
+	}
+	return found != p.negate
+}
+
+// compile checks the rule and readies its patterns.
+func (r *tagRule) compile() error {
+	if !tagName.MatchString(r.Tag) {
+		return fmt.Errorf("tag %q must be letters, digits, _, @, # and %%", r.Tag)
+	}
+	var err error
+	for _, field := range []struct {
+		name    string
+		pattern string
+		p       **tagPattern
+	}{
+		{"summary", r.Summary, &r.summary},
+		{"organizer", r.Organizer, &r.organizer},
+		{"calendar", r.Calendar, &r.calendar},
+		{"attendee", r.Attendee, &r.attendee},
+	} {
+		if *field.p, err = compilePattern(field.pattern); err != nil {
+			return fmt.Errorf("bad %s pattern: %v", field.name, err)
+		}
+	}
+	if r.summary == nil && r.organizer == nil && r.calendar == nil && r.attendee == nil {
+		return fmt.Errorf("tag %s has no pattern", r.Tag)
+	}
+	return nil
+}
+
+func (r *tagRule) matches(ev *agendaEvent) bool {
+	if r.summary != nil && !r.summary.matches(ev.Summary) {
+		return false
+	}
+	if r.organizer != nil {
+		var name, email string
+		if ev.Organizer != nil {
+			name, email = ev.Organizer.DisplayName, ev.Organizer.Email
+		}
+		if !r.organizer.matches(name, email) {
+			return false
+		}
+	}
+	if r.calendar != nil && !r.calendar.matches(ev.Calendar, ev.CalendarID) {
+		return false
+	}
+	if r.attendee != nil {
+		for _, att := range ev.Attendees {
+			if r.attendee.matches(att.DisplayName, att.Email) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// tagEvents gives the events the tags of the profile's rules they match.
+func tagEvents(events []*agendaEvent) {
+	for _, ev := range events {
+		for _, rule := range prof.Tags {
+			if rule.matches(ev) && !slices.Contains(ev.Tags, rule.Tag) {
+				ev.Tags = append(ev.Tags, rule.Tag)
+			}
+		}
+	}
+}
+
+// remindTags are the TAG clauses for the event's tags.
+func remindTags(ev *agendaEvent) string {
+	var b strings.Builder
+	for _, tag := range ev.Tags {
+		b.WriteString(" TAG " + tag)
+	}
+	return b.String()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"google.golang.org/api/tasks/v1"
+)
+
+func init() {
+	register(&command{
+		name:    "tasks",
+		summary: "Print the Google Tasks due in the window",
+		run:     runTasks,
+	})
+}
+
+func runTasks(args []string) error {
+	if err := checkFormat(); err != nil {
+		return err
+	}
+	localzone, err := localZone()
+	if err != nil {
+		return err
+	}
+	tasklist, err := collectTasks(context.Background(), duration, localzone)
+	if err != nil {
+		return err
+	}
+	return printEvents(tasklist, nil)
+}
+
+// collectTasks fetches the open tasks due in the window from every task
+// list. They come back as all-day events marked as tasks, so that the
+// formatters can render them as TODO items.
+func collectTasks(ctx context.Context, dur string, localzone *time.Location) ([]*agendaEvent, error) {
+	start, end, err := agendaWindow(time.Now().Local(), dur)
+	if err != nil {
+		return nil, err
+	}
+	client, err := googleClient()
+	if err != nil {
+		return nil, err
+	}
+	srv, err := tasks.NewService(ctx, option.WithHTTPClient(client))
+	if err != nil {
+		return nil, apiError("unable to retrieve Tasks client: %v", err)
+	}
+	lists, err := srv.Tasklists.List().Do()
+	if err != nil {
+		return nil, tasksError(err)
+	}
+	collected := make([]*agendaEvent, 0)
+	for _, list := range lists.Items {
+		// The API only knows the due date, and sends it as midnight UTC,
+		// so widen the window by a day on each side and filter below.
+		log.Debugf("Querying task list %s for tasks from %s to %s", list.Id, start, end)
+		err := srv.Tasks.List(list.Id).ShowCompleted(false).
+			DueMin(start.AddDate(0, 0, -1).Format(time.RFC3339)).
+			DueMax(end.AddDate(0, 0, 1).Format(time.RFC3339)).
+			Pages(ctx, func(page *tasks.Tasks) error {
+				for _, task := range page.Items {
+					if ev := taskEvent(task, list, start, end, localzone); ev != nil {
+						collected = append(collected, ev)
+					}
+				}
+				return nil
+			})
+		if err != nil {
+			return nil, tasksError(err)
+		}
+	}
+	log.Debugf("Found %d tasks", len(collected))
+	return collected, nil
+}
+
+func taskEvent(task *tasks.Task, list *tasks.TaskList, start, end time.Time, localzone *time.Location) *agendaEvent {
+	due, err := time.Parse(time.RFC3339, task.Due)
+	if err != nil {
+		log.Warningf("skipping task %s in list %s: bad due date %q", task.Id, list.Id, task.Due)
+		return nil
+	}
+	// Keep the date, in our own timezone.
+	day := time.Date(due.Year(), due.Month(), due.Day(), 0, 0, 0, 0, localzone)
+	if day.Before(start) || !day.Before(end) {
+		return nil
+	}
+	date := day.Format("2006-01-02")
+	return &agendaEvent{
+		Event: &calendar.Event{
+			Id:          task.Id,
+			Summary:     task.Title,
+			Description: task.Notes,
+			HtmlLink:    task.WebViewLink,
+			Start:       &calendar.EventDateTime{Date: date},
+			End:         &calendar.EventDateTime{Date: date},
+		},
+		Calendar:   strings.TrimSpace(list.Title),
+		CalendarID: list.Id,
+		Settings:   &calendarConfig{},
+		Start:      day,
+		End:        day.AddDate(0, 0, 1),
+		AllDay:     true,
+		Task:       true,
+	}
+}
+
+// tasksError explains the most likely cause of a permission failure: a
+// token saved before gcal asked for access to tasks.
+func tasksError(err error) error {
+	if gerr, ok := err.(*googleapi.Error); ok && gerr.Code == http.StatusForbidden {
+		return authError("unable to read tasks (%v); run gcal auth -force "+
+			"to grant access to Google Tasks", err)
+	}
+	return requestError(err, "unable to retrieve tasks")
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+var (
+	twInto   string
+	twLength time.Duration
+)
+
+func init() {
+	formatters["taskwarrior"] = formatTaskwarrior
+	formatExtensions["taskwarrior"] = ".json"
+	register(&command{
+		name:    "import-tasks",
+		args:    "[file]",
+		summary: "Add the pending Taskwarrior tasks that have a due date to the calendar",
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&twInto, "into", "primary", "Calendar to add the tasks to")
+			fs.DurationVar(&twLength, "length", 30*time.Minute, "How long the events for tasks due at a given time last")
+		},
+		run: runImportTasks,
+	})
+}
+
+// twMapping is what we remember between runs about Taskwarrior: the
+// UUIDs we gave events, so that re-importing updates tasks instead of
+// adding new ones, and the tasks we made events of.
+type twMapping struct {
+	UUIDs    map[string]string `json:"uuids"`
+	Imported map[string]string `json:"imported"`
+}
+
+func loadTWMapping() (*twMapping, string, error) {
+	path, err := cachePath("taskwarrior.json")
+	if err != nil {
+		return nil, "", err
+	}
+	m := &twMapping{UUIDs: map[string]string{}, Imported: map[string]string{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, path, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, "", fmt.Errorf("unable to parse %s: %v", path, err)
+	}
+	if m.UUIDs == nil {
+		m.UUIDs = map[string]string{}
+	}
+	if m.Imported == nil {
+		m.Imported = map[string]string{}
+	}
+	return m, path, nil
+}
+
+func saveTWMapping(path string, m *twMapping) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Dir(path)); err != nil {
+		err := mutate("create directory "+filepath.Dir(path), func() error {
+			return os.MkdirAll(filepath.Dir(path), 0700)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return writeFile(path, b, 0600)
+}
+
+// twUUIDs is the mapping formatTaskwarrior gives events their UUIDs
+// from, loaded the first time it is needed. Formatting only adds to it;
+// the agenda saves it with saveTWUUIDs once the tasks are printed.
+var twUUIDs struct {
+	m     *twMapping
+	path  string
+	added bool
+}
+
+// saveTWUUIDs saves the UUIDs formatTaskwarrior gave new events, if it
+// gave any.
+func saveTWUUIDs() error {
+	if !twUUIDs.added {
+		return nil
+	}
+	if err := saveTWMapping(twUUIDs.path, twUUIDs.m); err != nil {
+		return err
+	}
+	twUUIDs.added = false
+	return nil
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("unable to make a UUID: %v", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// twDate is Taskwarrior's date format.
+const twDate = "20060102T150405Z"
+
+// twTask is a task as task import and task export have it.
+type twTask struct {
+	UUID        string   `json:"uuid"`
+	Description string   `json:"description"`
+	Status      string   `json:"status"`
+	Entry       string   `json:"entry,omitempty"`
+	Due         string   `json:"due,omitempty"`
+	End         string   `json:"end,omitempty"`
+	Project     string   `json:"project,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+// twProject is the project for a calendar. Taskwarrior splits projects
+// on dots, and words on spaces.
+func twProject(calendar string) string {
+	return strings.NewReplacer(" ", "_", ".", "_").Replace(strings.TrimSpace(calendar))
+}
+
+// formatTaskwarrior writes the events as tasks for task import: due when
+// they start, in a project named after their calendar, and done once
+// they are over.
+func formatTaskwarrior(w io.Writer, events []*agendaEvent) error {
+	if twUUIDs.m == nil {
+		m, path, err := loadTWMapping()
+		if err != nil {
+			return err
+		}
+		twUUIDs.m, twUUIDs.path = m, path
+	}
+	m := twUUIDs.m
+	now := time.Now()
+	tasks := make([]*twTask, 0, len(events))
+	for _, ev := range sortedByStart(events) {
+		id := ev.StableID()
+		uuid, ok := m.UUIDs[id]
+		if !ok {
+			var err error
+			if uuid, err = newUUID(); err != nil {
+				return err
+			}
+			m.UUIDs[id] = uuid
+			twUUIDs.added = true
+		}
+		task := &twTask{
+			UUID:        uuid,
+			Description: summary(ev),
+			Status:      "pending",
+			Due:         ev.Start.UTC().Format(twDate),
+			Project:     twProject(ev.Calendar),
+			Tags:        []string{"gcal"},
+		}
+		if created, err := time.Parse(time.RFC3339, ev.Created); err == nil {
+			task.Entry = created.UTC().Format(twDate)
+		}
+		if ev.Kind != "" {
+			task.Tags = append(task.Tags, ev.Kind)
+		}
+		if !ev.Task && !ev.End.After(now) {
+			task.Status = "completed"
+			task.End = ev.End.UTC().Format(twDate)
+		}
+		tasks = append(tasks, task)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(tasks)
+}
+
+// twEvent is the calendar event for a task: all day if it is due at
+// midnight, which is what Taskwarrior makes of a date, and lasting
+// -length otherwise.
+func twEvent(task *twTask, localzone *time.Location) (*calendar.Event, error) {
+	due, err := time.Parse(twDate, task.Due)
+	if err != nil {
+		return nil, fmt.Errorf("task %s: bad due date %q", task.UUID, task.Due)
+	}
+	due = due.In(localzone)
+	ev := &calendar.Event{
+		Summary:     task.Description,
+		Description: "Taskwarrior task " + task.UUID,
+	}
+	if due.Hour() == 0 && due.Minute() == 0 && due.Second() == 0 {
+		ev.Start = eventDateTime(due, true)
+		ev.End = eventDateTime(due.AddDate(0, 0, 1), true)
+	} else {
+		ev.Start = &calendar.EventDateTime{DateTime: due.Format(time.RFC3339)}
+		ev.End = &calendar.EventDateTime{DateTime: due.Add(twLength).Format(time.RFC3339)}
+	}
+	return ev, nil
+}
+
+func runImportTasks(args []string) error {
+	if len(args) > 1 {
+		return usageError("usage: gcal import-tasks [file]")
+	}
+	if prof.Provider != "google" {
+		return usageError("adding events is only available with Google")
+	}
+	scopes = append(scopes, calendar.CalendarEventsScope)
+	in := os.Stdin
+	if len(args) == 1 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return usageError("%v", err)
+		}
+		defer f.Close()
+		in = f
+	}
+	var tasks []*twTask
+	if err := json.NewDecoder(in).Decode(&tasks); err != nil {
+		return usageError("unable to read the tasks (the output of task export): %v", err)
+	}
+	localzone, err := localZone()
+	if err != nil {
+		return err
+	}
+	m, path, err := loadTWMapping()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	p, err := newGoogleProvider(ctx)
+	if err != nil {
+		return err
+	}
+	added := 0
+	for _, task := range tasks {
+		// Tasks we made from events would only come back as duplicates.
+		fromGcal := false
+		for _, tag := range task.Tags {
+			fromGcal = fromGcal || tag == "gcal"
+		}
+		if task.Status != "pending" || task.Due == "" || fromGcal || m.Imported[task.UUID] != "" {
+			continue
+		}
+		ev, err := twEvent(task, localzone)
+		if err != nil {
+			log.Warningf("skipping %v", err)
+			continue
+		}
+		created, err := p.(writer).Insert(ctx, twInto, ev)
+		if err != nil {
+			return err
+		}
+		if !dryRun {
+			m.Imported[task.UUID] = created.Id
+		}
+		added++
+	}
+	log.Infof("Added %d tasks to %s", added, twInto)
+	if added == 0 || dryRun {
+		return nil
+	}
+	return saveTWMapping(path, m)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"time"
+)
+
+var (
+	alsoTZ    string
+	alsoZones []*time.Location
+)
+
+func init() {
+	flag.StringVar(&alsoTZ, "also-tz", "", "Also show event times in these zones (comma separated, e.g. America/Los_Angeles,Asia/Tokyo)")
+}
+
+// loadAlsoZones parses -also-tz into alsoZones.
+func loadAlsoZones() error {
+	alsoZones = nil
+	for _, name := range strings.Split(alsoTZ, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return usageError("bad -also-tz zone %q: %v", name, err)
+		}
+		alsoZones = append(alsoZones, loc)
+	}
+	return nil
+}
+
+// alsoTimes is the start of a timed event in the -also-tz zones, as in
+// " (07:00 PDT, Fri 00:00 JST)", with the day given where it differs
+// from the local one. It is empty for all-day events and tasks.
+func alsoTimes(ev *agendaEvent) string {
+	if len(alsoZones) == 0 || ev.AllDay || ev.Task {
+		return ""
+	}
+	times := make([]string, 0, len(alsoZones))
+	for _, loc := range alsoZones {
+		t := ev.Start.In(loc)
+		layout := "15:04 MST"
+		if t.Day() != ev.Start.Day() {
+			layout = "Mon 15:04 MST"
+		}
+		times = append(times, t.Format(layout))
+	}
+	return " (" + strings.Join(times, ", ") + ")"
+}
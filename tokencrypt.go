@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+var (
+	encryptToken bool
+	tokenKeyFile string
+	// tokenEncrypted records that the token file we read was encrypted,
+	// so that saving a refreshed token keeps it that way.
+	tokenEncrypted bool
+	// passphrase is remembered once asked for, so that it is asked for
+	// at most once per run.
+	passphrase []byte
+)
+
+func init() {
+	flag.BoolVar(&encryptToken, "encrypt-token", false, "Encrypt the token file with a passphrase (GCAL_TOKEN_PASSPHRASE, -token-key or asked for)")
+	flag.StringVar(&tokenKeyFile, "token-key", "", "File holding the passphrase for an encrypted token file")
+}
+
+// tokenMagic starts encrypted token files, so that they can be told
+// from plain JSON ones when read.
+const tokenMagic = "gcal-encrypted-token-v1\n"
+
+const (
+	saltSize  = 16
+	nonceSize = 24
+)
+
+// tokenPassphrase finds the passphrase for the token file: the -token-key
+// file, then $GCAL_TOKEN_PASSPHRASE, then asking on the terminal.
+func tokenPassphrase() ([]byte, error) {
+	if passphrase != nil {
+		return passphrase, nil
+	}
+	switch {
+	case tokenKeyFile != "":
+		b, err := os.ReadFile(tokenKeyFile)
+		if err != nil {
+			return nil, authError("unable to read the token key: %v", err)
+		}
+		passphrase = bytes.TrimRight(b, "\r\n")
+	case os.Getenv("GCAL_TOKEN_PASSPHRASE") != "":
+		passphrase = []byte(os.Getenv("GCAL_TOKEN_PASSPHRASE"))
+	case term.IsTerminal(int(os.Stdin.Fd())):
+		fmt.Fprint(os.Stderr, "Passphrase for the token file: ")
+		b, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, authError("unable to read the passphrase: %v", err)
+		}
+		passphrase = b
+	default:
+		return nil, authError("the token file is encrypted; set GCAL_TOKEN_PASSPHRASE or use -token-key")
+	}
+	if len(passphrase) == 0 {
+		return nil, authError("empty passphrase for the token file")
+	}
+	return passphrase, nil
+}
+
+func tokenKey(salt []byte) (*[32]byte, error) {
+	pass, err := tokenPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	k, err := scrypt.Key(pass, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	var key [32]byte
+	copy(key[:], k)
+	return &key, nil
+}
+
+// sealToken encrypts a token file's contents with a key derived from the
+// passphrase, as the magic line then the base64 of salt, nonce and box.
+func sealToken(plain []byte) ([]byte, error) {
+	var salt [saltSize]byte
+	var nonce [nonceSize]byte
+	if _, err := rand.Read(salt[:]); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	key, err := tokenKey(salt[:])
+	if err != nil {
+		return nil, err
+	}
+	sealed := secretbox.Seal(append(salt[:], nonce[:]...), plain, &nonce, key)
+	return []byte(tokenMagic + base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+// openToken decrypts a token file's contents if they are encrypted, and
+// returns them as they are otherwise.
+func openToken(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(tokenMagic)) {
+		return data, nil
+	}
+	tokenEncrypted = true
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data[len(tokenMagic):])))
+	if err != nil || len(sealed) < saltSize+nonceSize+secretbox.Overhead {
+		return nil, authError("the encrypted token file is corrupt")
+	}
+	var nonce [nonceSize]byte
+	copy(nonce[:], sealed[saltSize:])
+	key, err := tokenKey(sealed[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+	plain, ok := secretbox.Open(nil, sealed[saltSize+nonceSize:], &nonce, key)
+	if !ok {
+		return nil, authError("unable to decrypt the token file: wrong passphrase?")
+	}
+	return plain, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"net/http"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+var (
+	caCert             string
+	insecureSkipVerify bool
+	userAgent          string
+	// baseTransport carries every HTTP request gcal makes, once
+	// setupTransport has applied the flags to it.
+	baseTransport http.RoundTripper = http.DefaultTransport
+)
+
+func init() {
+	flag.StringVar(&caCert, "ca-cert", "", "PEM file of extra certificate authorities to trust, such as a corporate proxy's")
+	flag.BoolVar(&insecureSkipVerify, "insecure-skip-verify", false, "Do not verify TLS certificates (DANGEROUS: anyone on the network can read your calendars)")
+	flag.StringVar(&userAgent, "user-agent", "", "User-Agent header to send with every request")
+}
+
+// userAgentTransport sets the User-Agent of every request.
+type userAgentTransport struct {
+	agent string
+	next  http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.agent)
+	return t.next.RoundTrip(req)
+}
+
+// logTransport logs every request and how it went, for -vv.
+type logTransport struct {
+	next http.RoundTripper
+}
+
+func (t *logTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		log.Debugf("%s %s: %v", req.Method, req.URL.Redacted(), err)
+		return nil, err
+	}
+	log.Debugf("%s %s: %s in %v", req.Method, req.URL.Redacted(), resp.Status, time.Since(start).Round(time.Millisecond))
+	return resp, nil
+}
+
+// setupTransport builds the transport from the flags. Proxies come from
+// HTTPS_PROXY, HTTP_PROXY and NO_PROXY, as usual.
+func setupTransport() error {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = http.ProxyFromEnvironment
+	if caCert != "" || insecureSkipVerify {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	if caCert != "" {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return usageError("unable to read CA certificates: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return usageError("no certificates found in %s", caCert)
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+	if insecureSkipVerify {
+		log.Warning("*** -insecure-skip-verify: TLS certificates are NOT verified. " +
+			"Anyone between you and the server can read and change your calendars and steal your token. ***")
+		t.TLSClientConfig.InsecureSkipVerify = true
+	}
+	baseTransport = &rateLimitTransport{&rateLimiter{}, t}
+	if userAgent != "" {
+		baseTransport = &userAgentTransport{userAgent, baseTransport}
+	}
+	if vverbose {
+		baseTransport = &logTransport{baseTransport}
+	}
+	return nil
+}
+
+// httpClient returns a client going through the transport, with a
+// timeout unless it is 0.
+func httpClient(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: baseTransport, Timeout: timeout}
+}
+
+// oauthContext is the context for OAuth requests, which makes the
+// oauth2 package use our transport, both for getting tokens and under
+// the clients it returns.
+func oauthContext() context.Context {
+	return context.WithValue(context.Background(), oauth2.HTTPClient, httpClient(0))
+}
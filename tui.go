@@ -0,0 +1,529 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+	"google.golang.org/api/calendar/v3"
+)
+
+var tuiWrite bool
+
+func init() {
+	register(&command{
+		name:    "tui",
+		summary: "Browse the calendars in a full-screen terminal interface",
+		flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&tuiWrite, "write", false, "Allow answering invitations, creating and deleting events (needs a token with write access)")
+		},
+		run: runTUI,
+	})
+}
+
+// Views of the calendar browser.
+const (
+	viewDay   = "day"
+	viewWeek  = "week"
+	viewMonth = "month"
+)
+
+// browser is the state of the calendar browser.
+type browser struct {
+	ctx       context.Context
+	localzone *time.Location
+	view      string
+	// day is the day the cursor is on, at midnight, and selected the
+	// index of the selected event among that day's.
+	day      time.Time
+	selected int
+	// events were loaded for [loadedFrom, loadedTo).
+	events     []*agendaEvent
+	loadedFrom time.Time
+	loadedTo   time.Time
+	details    bool
+	status     string
+}
+
+// load fetches the events of the weeks around the cursor's month, if
+// they aren't loaded yet or reload is set. It goes through -from and
+// -to, so that the usual calendar selection and filters apply.
+func (b *browser) load(reload bool) error {
+	if !reload && !b.day.Before(b.loadedFrom) && b.day.Before(b.loadedTo) {
+		return nil
+	}
+	month, _ := periodOf(b.day, "month")
+	first, _ := periodOf(month.start, "week")
+	last, _ := periodOf(month.end.AddDate(0, 0, -1), "week")
+	fromDate = first.start.Format("2006-01-02")
+	toDate = last.end.AddDate(0, 0, -1).Format("2006-01-02")
+	events, _, err := agendaEvents(b.ctx, duration, b.localzone)
+	if err != nil {
+		return err
+	}
+	b.events = sortedByStart(events)
+	b.loadedFrom, b.loadedTo = first.start, last.end
+	return nil
+}
+
+// eventsOn are the events overlapping the day, in order.
+func (b *browser) eventsOn(day time.Time) []*agendaEvent {
+	next := day.AddDate(0, 0, 1)
+	on := make([]*agendaEvent, 0)
+	for _, ev := range b.events {
+		end := ev.End
+		if !end.After(ev.Start) {
+			end = ev.Start.Add(time.Minute)
+		}
+		if ev.Start.Before(next) && end.After(day) {
+			on = append(on, ev)
+		}
+	}
+	return on
+}
+
+func (b *browser) current() *agendaEvent {
+	on := b.eventsOn(b.day)
+	if b.selected < len(on) {
+		return on[b.selected]
+	}
+	return nil
+}
+
+// move puts the cursor on another day, loading its events if needed.
+func (b *browser) move(day time.Time) {
+	b.day = midnight(day)
+	b.selected = 0
+	if err := b.load(false); err != nil {
+		b.status = err.Error()
+	}
+}
+
+// pad cuts or pads s with spaces to exactly n columns.
+func pad(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	s = truncateRunes(s, n)
+	return s + strings.Repeat(" ", n-utf8.RuneCountInString(s))
+}
+
+const (
+	reverse = "\x1b[7m"
+	bold    = "\x1b[1m"
+	dim     = "\x1b[2m"
+	reset   = "\x1b[0m"
+)
+
+// eventLine is an event in the day and week views.
+func eventLine(ev *agendaEvent) string {
+	when := ev.Start.Format("15:04") + "-" + ev.End.Format("15:04")
+	if ev.Task {
+		when = "todo"
+	} else if ev.AllDay {
+		when = "all day"
+	}
+	return fmt.Sprintf("%-11s %s", when, markedSummary(ev))
+}
+
+// line is one line of the screen, with the style to draw it in.
+type line struct {
+	text  string
+	style string
+}
+
+func (b *browser) dayLines(width int) []line {
+	lines := []line{{b.day.Format("Monday, January 2 2006"), bold}}
+	on := b.eventsOn(b.day)
+	for i, ev := range on {
+		style := ""
+		if i == b.selected {
+			style = reverse
+		} else if ev.Demoted {
+			style = dim
+		}
+		lines = append(lines, line{"  " + eventLine(ev), style})
+	}
+	if len(on) == 0 {
+		lines = append(lines, line{"  Nothing scheduled.", dim})
+	}
+	return lines
+}
+
+func (b *browser) weekLines(width int) []line {
+	week, _ := periodOf(b.day, "week")
+	lines := make([]line, 0)
+	for day := week.start; day.Before(week.end); day = day.AddDate(0, 0, 1) {
+		style := bold
+		if sameDay(day, b.day) {
+			style = bold + reverse
+		}
+		lines = append(lines, line{day.Format("Mon Jan 02"), style})
+		for i, ev := range b.eventsOn(day) {
+			style := ""
+			if sameDay(day, b.day) && i == b.selected {
+				style = reverse
+			} else if ev.Demoted {
+				style = dim
+			}
+			lines = append(lines, line{"  " + eventLine(ev), style})
+		}
+	}
+	return lines
+}
+
+func (b *browser) monthLines(width int) []line {
+	month, _ := periodOf(b.day, "month")
+	first, _ := periodOf(month.start, "week")
+	cell := max(width/7, 4)
+	lines := []line{{b.day.Format("January 2006"), bold}}
+	var header strings.Builder
+	for d := first.start; d.Before(first.end); d = d.AddDate(0, 0, 1) {
+		header.WriteString(pad(d.Format("Mon"), cell))
+	}
+	lines = append(lines, line{header.String(), dim})
+	today := midnight(time.Now().In(b.localzone))
+	for week := first.start; week.Before(month.end); week = week.AddDate(0, 0, 7) {
+		// Each week is a row of cells three lines high: the date and the
+		// first two events.
+		var rows [3]bytes.Buffer
+		for i := 0; i < 7; i++ {
+			day := week.AddDate(0, 0, i)
+			on := b.eventsOn(day)
+			label := day.Format("2")
+			if sameDay(day, today) {
+				label += "*"
+			}
+			texts := [3]string{label, "", ""}
+			for j := 0; j < 2 && j < len(on); j++ {
+				texts[j+1] = summary(on[j])
+			}
+			if len(on) > 2 {
+				texts[2] = fmt.Sprintf("+%d more", len(on)-1)
+			}
+			for r, text := range texts {
+				text = pad(text, cell-1) + " "
+				switch {
+				case sameDay(day, b.day):
+					text = reverse + text + reset
+				case day.Month() != b.day.Month():
+					text = dim + text + reset
+				}
+				rows[r].WriteString(text)
+			}
+		}
+		for _, row := range rows {
+			// The cells carry their own styles.
+			lines = append(lines, line{row.String(), "raw"})
+		}
+	}
+	lines = append(lines, line{"", ""})
+	return append(lines, b.dayLines(width)...)
+}
+
+// detailLines are the selected event's details, cut to the width.
+func (b *browser) detailLines(width int) []line {
+	ev := b.current()
+	if ev == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	eventDetails(&buf, ev)
+	lines := make([]line, 0)
+	for _, text := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+		// Wrap long lines, such as descriptions.
+		runes := []rune(strings.ReplaceAll(text, "\t", "    "))
+		for len(runes) > width && width > 0 {
+			lines = append(lines, line{string(runes[:width]), ""})
+			runes = runes[width:]
+		}
+		lines = append(lines, line{string(runes), ""})
+	}
+	lines[0].style = bold
+	return lines
+}
+
+const tuiHelp = "d/w/m view  ←→ day  ↑↓ event  [ ] page  t today  enter details  r reload  q quit"
+const tuiWriteHelp = "  A/M/D accept/maybe/decline  c create  x delete"
+
+// draw renders the whole screen.
+func (b *browser) draw(w io.Writer, width, height int) {
+	var buf bytes.Buffer
+	buf.WriteString("\x1b[H\x1b[2J")
+	listWidth := width
+	side := b.details && width >= 100
+	if side {
+		listWidth = width * 55 / 100
+	}
+	var lines []line
+	switch b.view {
+	case viewDay:
+		lines = b.dayLines(listWidth)
+	case viewWeek:
+		lines = b.weekLines(listWidth)
+	default:
+		lines = b.monthLines(listWidth)
+	}
+	var details []line
+	if b.details {
+		details = b.detailLines(width - listWidth - 3)
+		if !side {
+			details = b.detailLines(width)
+			lines = append(append(lines, line{strings.Repeat("─", width), dim}), details...)
+			details = nil
+		}
+	}
+	// Scroll so that the selection shows.
+	rows := height - 2
+	first := 0
+	for i, l := range lines {
+		if strings.Contains(l.style, reverse) && i >= rows {
+			first = i - rows + 1
+			break
+		}
+	}
+	for r := 0; r < rows; r++ {
+		i := first + r
+		if i < len(lines) {
+			l := lines[i]
+			switch l.style {
+			case "raw":
+				buf.WriteString(l.text)
+			case "":
+				buf.WriteString(pad(l.text, listWidth))
+			default:
+				buf.WriteString(l.style + pad(l.text, listWidth) + reset)
+			}
+		} else {
+			buf.WriteString(strings.Repeat(" ", listWidth))
+		}
+		if side && r < len(details) {
+			d := details[r]
+			buf.WriteString(" │ " + d.style + pad(d.text, width-listWidth-3) + reset)
+		} else if side {
+			buf.WriteString(" │")
+		}
+		buf.WriteString("\r\n")
+	}
+	help := tuiHelp
+	if tuiWrite {
+		help += tuiWriteHelp
+	}
+	buf.WriteString(dim + pad(help, width) + reset + "\r\n")
+	buf.WriteString(pad(b.status, width))
+	w.Write(buf.Bytes())
+}
+
+// prompt reads a line of text on the status line. It returns false if
+// the user gave up with Escape or Ctrl-C.
+func prompt(in io.Reader, out io.Writer, label string) (string, bool) {
+	text := []rune{}
+	buf := make([]byte, 64)
+	for {
+		fmt.Fprintf(out, "\r\x1b[K%s%s", label, string(text))
+		n, err := in.Read(buf)
+		if err != nil {
+			return "", false
+		}
+		key := buf[:n]
+		switch {
+		case n == 1 && (key[0] == keyCtrlC || key[0] == keyEscape):
+			return "", false
+		case n == 1 && key[0] == keyEnter:
+			return string(text), true
+		case n == 1 && (key[0] == keyBackspace || key[0] == '\b'):
+			if len(text) > 0 {
+				text = text[:len(text)-1]
+			}
+		case key[0] != keyEscape:
+			for _, r := range string(key) {
+				if unicode.IsPrint(r) {
+					text = append(text, r)
+				}
+			}
+		}
+	}
+}
+
+// act carries out the writing commands.
+func (b *browser) act(key byte, in io.Reader, out io.Writer) {
+	if !tuiWrite {
+		b.status = "run gcal tui -write to change events"
+		return
+	}
+	if key == 'c' {
+		text, ok := prompt(in, out, "New event (e.g. \"Lunch with Sam friday at noon\"): ")
+		if !ok || strings.TrimSpace(text) == "" {
+			b.status = ""
+			return
+		}
+		ps, err := sources(b.ctx)
+		if err != nil {
+			b.status = err.Error()
+			return
+		}
+		w, ok := ps[0].(writer)
+		if !ok {
+			b.status = "this provider can't create events"
+			return
+		}
+		created, err := w.QuickAdd(b.ctx, "primary", text)
+		if err != nil {
+			b.status = err.Error()
+			return
+		}
+		b.status = "created " + created.Summary
+		if err := b.load(true); err != nil {
+			b.status = err.Error()
+		}
+		return
+	}
+	ev := b.current()
+	if ev == nil {
+		return
+	}
+	w, ok := ev.Provider.(writer)
+	if !ok || ev.Task {
+		b.status = "this event can't be changed from gcal"
+		return
+	}
+	var err error
+	switch key {
+	case 'A':
+		err = w.Respond(b.ctx, ev, "accepted")
+	case 'M':
+		err = w.Respond(b.ctx, ev, "tentative")
+	case 'D':
+		err = w.Respond(b.ctx, ev, "declined")
+	case 'x':
+		answer, ok := prompt(in, out, fmt.Sprintf("Delete %q? (y/n) ", summary(ev)))
+		if !ok || !strings.EqualFold(strings.TrimSpace(answer), "y") {
+			b.status = ""
+			return
+		}
+		err = w.Delete(b.ctx, ev)
+	}
+	if err != nil {
+		b.status = err.Error()
+		return
+	}
+	b.status = "done"
+	if err := b.load(true); err != nil {
+		b.status = err.Error()
+	}
+}
+
+// handle reacts to a key, and reports whether to carry on.
+func (b *browser) handle(key []byte, in io.Reader, out io.Writer) bool {
+	n := len(b.eventsOn(b.day))
+	page := map[string][3]int{viewDay: {0, 0, 1}, viewWeek: {0, 0, 7}, viewMonth: {0, 1, 0}}[b.view]
+	switch {
+	case bytes.Equal(key, []byte("q")), len(key) == 1 && key[0] == keyCtrlC:
+		return false
+	case bytes.Equal(key, []byte("d")):
+		b.view = viewDay
+	case bytes.Equal(key, []byte("w")):
+		b.view = viewWeek
+	case bytes.Equal(key, []byte("m")):
+		b.view = viewMonth
+	case bytes.Equal(key, []byte("\x1b[D")), bytes.Equal(key, []byte("h")):
+		b.move(b.day.AddDate(0, 0, -1))
+	case bytes.Equal(key, []byte("\x1b[C")), bytes.Equal(key, []byte("l")):
+		b.move(b.day.AddDate(0, 0, 1))
+	case bytes.Equal(key, []byte("\x1b[A")), bytes.Equal(key, []byte("k")):
+		if b.selected > 0 {
+			b.selected--
+		} else if b.view == viewMonth {
+			b.move(b.day.AddDate(0, 0, -7))
+		}
+	case bytes.Equal(key, []byte("\x1b[B")), bytes.Equal(key, []byte("j")):
+		if b.selected < n-1 {
+			b.selected++
+		} else if b.view == viewMonth {
+			b.move(b.day.AddDate(0, 0, 7))
+		}
+	case bytes.Equal(key, []byte("[")):
+		b.move(b.day.AddDate(-page[0], -page[1], -page[2]))
+	case bytes.Equal(key, []byte("]")):
+		b.move(b.day.AddDate(page[0], page[1], page[2]))
+	case bytes.Equal(key, []byte("t")):
+		b.move(time.Now().In(b.localzone))
+	case len(key) == 1 && key[0] == keyEnter:
+		b.details = !b.details
+	case bytes.Equal(key, []byte("r")):
+		b.status = ""
+		if err := b.load(true); err != nil {
+			b.status = err.Error()
+		}
+	case len(key) == 1 && strings.IndexByte("AMDcx", key[0]) >= 0:
+		b.act(key[0], in, out)
+	}
+	return true
+}
+
+func runTUI(args []string) error {
+	if tuiWrite {
+		if prof.Provider != "google" {
+			return usageError("changing events is only available with Google")
+		}
+		scopes = append(scopes, calendar.CalendarEventsScope)
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return usageError("gcal tui needs a terminal")
+	}
+	if _, err := parseFilters(); err != nil {
+		return err
+	}
+	if err := loadAlsoZones(); err != nil {
+		return err
+	}
+	localzone, err := localZone()
+	if err != nil {
+		return err
+	}
+	b := &browser{
+		ctx:       context.Background(),
+		localzone: localzone,
+		view:      viewWeek,
+		day:       midnight(time.Now().In(localzone)),
+	}
+	// Load before taking over the screen, in case we have to ask for
+	// authorization.
+	if err := b.load(true); err != nil {
+		return err
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return usageError("unable to read the terminal: %v", err)
+	}
+	defer term.Restore(fd, state)
+	// Use the alternate screen, without a cursor, and put things back
+	// when done.
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+	buf := make([]byte, 64)
+	for {
+		width, height, err := term.GetSize(int(os.Stdout.Fd()))
+		if err != nil || width < 20 || height < 5 {
+			width, height = 80, 24
+		}
+		b.draw(os.Stdout, width, height)
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return err
+		}
+		if !b.handle(buf[:n], os.Stdin, os.Stdout) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+func init() {
+	register(&command{
+		name:    "export-vdir",
+		args:    "directory",
+		summary: "Mirror the window into a vdir, one .ics file per event, for khal and friends",
+		run:     runExportVdir,
+	})
+}
+
+// safeUID matches the UIDs that can be used as file names as they are.
+var safeUID = regexp.MustCompile(`^[A-Za-z0-9_@.+-]+$`)
+
+// vdirName is the file an event goes in: its UID if that is safe to use,
+// a hash of it otherwise, as the vdir spec suggests.
+func vdirName(uid string) string {
+	if safeUID.MatchString(uid) && !strings.HasPrefix(uid, ".") && len(uid) < 200 {
+		return uid + ".ics"
+	}
+	sum := sha1.Sum([]byte(uid))
+	return hex.EncodeToString(sum[:]) + ".ics"
+}
+
+// icsProdID marks the files we wrote, the only ones we ever delete.
+var icsProdID = []byte("PRODID:-//msoulier//gcal//EN")
+
+// withoutStamps drops the DTSTAMP lines, which change on every run, so
+// that files are only rewritten when an event changes.
+func withoutStamps(data []byte) []byte {
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	kept := make([][]byte, 0, len(lines))
+	for _, line := range lines {
+		if !bytes.HasPrefix(line, []byte("DTSTAMP")) {
+			kept = append(kept, line)
+		}
+	}
+	return bytes.Join(kept, nil)
+}
+
+// exportVdir writes the events into dir, one file per UID, so that the
+// instances of a recurring event share a file. It deletes the files it
+// wrote before for events that are no longer there.
+func exportVdir(dir string, events []*agendaEvent) error {
+	if _, err := os.Stat(dir); err != nil {
+		err := mutate("create directory "+dir, func() error {
+			return os.MkdirAll(dir, 0755)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	byUID := map[string][]*agendaEvent{}
+	for _, ev := range sortedByStart(events) {
+		uid := icsUID(ev)
+		byUID[uid] = append(byUID[uid], ev)
+	}
+	uids := make([]string, 0, len(byUID))
+	for uid := range byUID {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+
+	written := map[string]bool{}
+	changed := 0
+	for _, uid := range uids {
+		name := vdirName(uid)
+		path := filepath.Join(dir, name)
+		written[name] = true
+		var buf bytes.Buffer
+		if err := formatICS(&buf, byUID[uid]); err != nil {
+			return err
+		}
+		if old, err := os.ReadFile(path); err == nil && bytes.Equal(withoutStamps(old), withoutStamps(buf.Bytes())) {
+			continue
+		}
+		if err := writeFile(path, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+		changed++
+	}
+	if name := commonCalendar(events); name != "" {
+		// khal and vdirsyncer read the collection's name from here.
+		path := filepath.Join(dir, "displayname")
+		if old, err := os.ReadFile(path); err != nil || string(old) != name+"\n" {
+			if err := writeFile(path, []byte(name+"\n"), 0644); err != nil {
+				return err
+			}
+		}
+	}
+
+	if someCalendarsFailed() {
+		// Their events aren't among those written, but aren't gone.
+		log.Warningf("%s: not deleting stale files, as some calendars couldn't be read", dir)
+		log.Infof("%s: %d files written, %d unchanged", dir, changed, len(uids)-changed)
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !dryRun {
+		return err
+	}
+	deleted := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if written[name] || entry.IsDir() || !strings.HasSuffix(name, ".ics") {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil || !bytes.Contains(data, icsProdID) {
+			continue
+		}
+		if err := removeFile(path); err != nil {
+			return err
+		}
+		deleted++
+	}
+	log.Infof("%s: %d files written, %d unchanged, %d deleted", dir, changed, len(uids)-changed, deleted)
+	return nil
+}
+
+func runExportVdir(args []string) error {
+	if len(args) != 1 {
+		return usageError("usage: gcal export-vdir directory")
+	}
+	if _, err := parseFilters(); err != nil {
+		return err
+	}
+	localzone, err := localZone()
+	if err != nil {
+		return err
+	}
+	events, _, err := agendaEvents(context.Background(), duration, localzone)
+	if err != nil {
+		return err
+	}
+	return exportVdir(args[0], events)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	rdebug "runtime/debug"
+)
+
+// Build metadata, set at build time with
+//
+//	go build -ldflags "-X main.version=1.0 -X main.commit=abc123 -X main.date=2025-01-05"
+//
+// The Makefile does this from git.
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+var showVersion bool
+
+func init() {
+	flag.BoolVar(&showVersion, "version", false, "Print version information and exit")
+	register(&command{
+		name:    "version",
+		summary: "Print version information",
+		run: func(args []string) error {
+			printVersion()
+			return nil
+		},
+	})
+}
+
+// buildInfo fills in whatever the linker flags did not set from the
+// metadata the go tool embeds, e.g. for "go install".
+func buildInfo() (string, string, string) {
+	v, c, d := version, commit, date
+	info, ok := rdebug.ReadBuildInfo()
+	if !ok {
+		return v, c, d
+	}
+	if v == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		v = info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if c == "" {
+				c = setting.Value
+			}
+		case "vcs.time":
+			if d == "" {
+				d = setting.Value
+			}
+		case "vcs.modified":
+			if setting.Value == "true" && c != "" && commit == "" {
+				c += "-dirty"
+			}
+		}
+	}
+	return v, c, d
+}
+
+func printVersion() {
+	v, c, d := buildInfo()
+	if c == "" {
+		c = "unknown"
+	}
+	if d == "" {
+		d = "unknown"
+	}
+	fmt.Printf("gcal %s\ncommit: %s\nbuilt: %s\ngo: %s %s/%s\n",
+		v, c, d, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}